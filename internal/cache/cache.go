@@ -1,91 +1,449 @@
 package cache
 
 import (
+	"container/list"
+	"hash/maphash"
+	"maps"
+	"net/netip"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/akl7777777/ip-intel/internal/model"
 )
 
+const (
+	// maxShards bounds the number of lock stripes.
+	maxShards = 64
+	// minShardEntries keeps shards large enough that per-shard LRU stays
+	// close to a global LRU; small caches use fewer shards, down to one.
+	minShardEntries = 1024
+	// sweepInterval is how often expired entries are removed.
+	sweepInterval = time.Second
+	// sweepBatch bounds the entries removed per shard lock hold, so that a
+	// sweep never blocks lookups for long.
+	sweepBatch = 128
+)
+
 type entry struct {
+	key       string
 	data      *model.IPInfo
+	storedAt  time.Time
 	expiresAt time.Time
+	hits      int64 // since stored
+	size      int64
+	lruEl     *list.Element // in shard.lru
+	expEl     *list.Element // in shard.expiry
+}
+
+// shard is one lock stripe. Entries are kept in two lists: lru orders them
+// by last use for eviction, expiry by expiration time for the sweep. With a
+// single TTL, appending on Set keeps expiry sorted.
+type shard struct {
+	mu         sync.Mutex
+	items      map[string]*entry
+	lru        list.List // front = most recently used
+	expiry     list.List // front = expires first
+	bytes      int64
+	maxEntries int   // 0 = unlimited
+	maxBytes   int64 // 0 = unlimited
+
+	hits       atomic.Int64
+	prefixHits atomic.Int64
+	misses     atomic.Int64
+	evictions  int64
 }
 
+// Cache is an in-memory TTL cache bounded by entry count and estimated memory.
+// Keys are spread over independently locked shards, each evicting its least
+// recently used entry when it reaches its share of the limits. Expired
+// entries are removed incrementally in small batches.
 type Cache struct {
-	mu     sync.RWMutex
-	items  map[string]*entry
-	ttl    time.Duration
-	stopCh chan struct{}
+	shards     []shard
+	seed       maphash.Seed
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int64
+	sweepBatch int // 0 = whole shard at once
+	stopCh     chan struct{}
+}
+
+// Stats are the cache counters since startup.
+type Stats struct {
+	Entries    int
+	Bytes      int64 // estimated memory held by the entries
+	Hits       int64 // including PrefixHits
+	PrefixHits int64 // hits answered by the entry of a neighbouring address
+	Misses     int64
+	Evictions  int64 // entries dropped to stay within the limits
+}
+
+// New creates a cache holding at most maxEntries entries and about maxBytes
+// bytes; 0 disables a limit.
+func New(ttl time.Duration, maxEntries int, maxBytes int64) *Cache {
+	return newSharded(ttl, shardCount(maxEntries, maxBytes), maxEntries, maxBytes, sweepBatch)
+}
+
+// shardCount returns the largest power of two up to maxShards that leaves
+// every shard at least minShardEntries entries (estimated from maxBytes with
+// about 1 KB per entry).
+func shardCount(maxEntries int, maxBytes int64) int {
+	limit := maxShards
+	if maxEntries > 0 {
+		limit = min(limit, maxEntries/minShardEntries)
+	}
+	if maxBytes > 0 {
+		limit = min(limit, int(maxBytes>>10)/minShardEntries)
+	}
+	n := 1
+	for n*2 <= limit {
+		n *= 2
+	}
+	return n
 }
 
-func New(ttl time.Duration) *Cache {
+func newSharded(ttl time.Duration, shards, maxEntries int, maxBytes int64, batch int) *Cache {
 	c := &Cache{
-		items:  make(map[string]*entry),
-		ttl:    ttl,
-		stopCh: make(chan struct{}),
+		shards:     make([]shard, shards),
+		seed:       maphash.MakeSeed(),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		sweepBatch: batch,
+		stopCh:     make(chan struct{}),
+	}
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.items = make(map[string]*entry)
+		// Round up so that the shards together hold at least the limit
+		s.maxEntries = (maxEntries + shards - 1) / shards
+		s.maxBytes = (maxBytes + int64(shards) - 1) / int64(shards)
 	}
 	go c.cleanup()
 	return c
 }
 
+func (c *Cache) shard(key string) *shard {
+	return &c.shards[maphash.String(c.seed, key)&uint64(len(c.shards)-1)]
+}
+
+// Hit describes a cache hit.
+type Hit struct {
+	Shared bool          // stored for another address of the network (see GetPrefix)
+	Age    time.Duration // since the entry was stored
+}
+
+// Get returns a copy of the cached result and counts a hit or miss. The
+// copy has its own Provenance and Confidence maps, so callers may modify it.
 func (c *Cache) Get(ip string) (*model.IPInfo, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	info, _, ok := c.get(ip)
+	c.count(ip, ok)
+	return info, ok
+}
 
-	e, ok := c.items[ip]
-	if !ok {
-		return nil, false
+// Peek is Get without counting, for re-checks of a lookup already counted.
+func (c *Cache) Peek(ip string) (*model.IPInfo, bool) {
+	info, _, ok := c.get(ip)
+	return info, ok
+}
+
+// GetPrefix is Get falling back to the entry stored with SetPrefix for p,
+// the network of ip. A shared result has its IP replaced by ip. An invalid p
+// disables the fallback.
+func (c *Cache) GetPrefix(ip string, p netip.Prefix) (*model.IPInfo, Hit, bool) {
+	info, age, ok := c.get(ip)
+	if ok || !p.IsValid() {
+		c.count(ip, ok)
+		return info, Hit{Age: age}, ok
+	}
+	key := p.Masked().String()
+	if info, age, ok = c.get(key); !ok {
+		c.count(ip, false)
+		return nil, Hit{}, false
 	}
-	if time.Now().After(e.expiresAt) {
-		return nil, false
+	s := c.shard(key)
+	s.hits.Add(1)
+	s.prefixHits.Add(1)
+	info.IP = ip
+	return info, Hit{Shared: true, Age: age}, true
+}
+
+func (c *Cache) count(key string, hit bool) {
+	if hit {
+		c.shard(key).hits.Add(1)
+	} else {
+		c.shard(key).misses.Add(1)
 	}
-	result := *e.data
+}
+
+func (c *Cache) get(key string) (*model.IPInfo, time.Duration, bool) {
+	now := time.Now()
+	s := c.shard(key)
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if ok && now.After(e.expiresAt) {
+		s.remove(e)
+		ok = false
+	}
+	if !ok {
+		s.mu.Unlock()
+		return nil, 0, false
+	}
+	s.lru.MoveToFront(e.lruEl)
+	e.hits++
+	data, age := e.data, now.Sub(e.storedAt)
+	s.mu.Unlock()
+
+	result := *data
 	result.Cached = true
-	return &result, true
+	result.Provenance = maps.Clone(data.Provenance)
+	result.Confidence = maps.Clone(data.Confidence)
+	return &result, age, true
 }
 
 func (c *Cache) Set(ip string, info *model.IPInfo) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.set(ip, info)
+}
+
+// SetPrefix stores info for every address in p that has no entry of its own.
+func (c *Cache) SetPrefix(p netip.Prefix, info *model.IPInfo) {
+	c.set(p.Masked().String(), info)
+}
+
+func (c *Cache) set(key string, info *model.IPInfo) {
+	size := entrySize(key, info)
+	now := time.Now()
+	expiresAt := now.Add(c.ttl)
+
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		s.bytes += size - e.size
+		e.data, e.size, e.storedAt, e.expiresAt, e.hits = info, size, now, expiresAt, 0
+		s.lru.MoveToFront(e.lruEl)
+		s.expiry.MoveToBack(e.expEl)
+	} else {
+		e := &entry{key: key, data: info, storedAt: now, expiresAt: expiresAt, size: size}
+		e.lruEl = s.lru.PushFront(e)
+		e.expEl = s.expiry.PushBack(e)
+		s.items[key] = e
+		s.bytes += size
+	}
+
+	for s.overLimit() {
+		s.remove(s.lru.Back().Value.(*entry))
+		s.evictions++
+	}
+}
+
+// overLimit reports whether an entry must be evicted. The newest entry is
+// always kept, even if it alone exceeds the memory budget.
+func (s *shard) overLimit() bool {
+	if s.lru.Len() <= 1 {
+		return false
+	}
+	return (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) ||
+		(s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+func (s *shard) remove(e *entry) {
+	s.lru.Remove(e.lruEl)
+	s.expiry.Remove(e.expEl)
+	delete(s.items, e.key)
+	s.bytes -= e.size
+}
+
+// expire removes up to batch expired entries (all if batch is 0) and reports
+// whether more may be left.
+func (s *shard) expire(now time.Time, batch int) bool {
+	for n := 0; batch == 0 || n < batch; n++ {
+		front := s.expiry.Front()
+		if front == nil || !now.After(front.Value.(*entry).expiresAt) {
+			return false
+		}
+		s.remove(front.Value.(*entry))
+	}
+	return true
+}
+
+// Hot returns up to limit keys of entries expiring before deadline that were
+// read at least minHits times since they were stored, soonest first across
+// all shards. A refresher can renew them before they expire.
+func (c *Cache) Hot(deadline time.Time, minHits int64, limit int) []string {
+	type candidate struct {
+		key       string
+		expiresAt time.Time
+	}
+	var found []candidate
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		// Each expiry list is ordered, so no shard contributes more than limit
+		n := 0
+		for el := s.expiry.Front(); el != nil && n < limit; el = el.Next() {
+			e := el.Value.(*entry)
+			if e.expiresAt.After(deadline) {
+				break
+			}
+			if e.hits >= minHits {
+				found = append(found, candidate{e.key, e.expiresAt})
+				n++
+			}
+		}
+		s.mu.Unlock()
+	}
 
-	c.items[ip] = &entry{
-		data:      info,
-		expiresAt: time.Now().Add(c.ttl),
+	slices.SortFunc(found, func(a, b candidate) int { return a.expiresAt.Compare(b.expiresAt) })
+	keys := make([]string, 0, min(limit, len(found)))
+	for _, f := range found[:min(limit, len(found))] {
+		keys = append(keys, f.key)
+	}
+	return keys
+}
+
+// RemoveFunc removes the entries for which fn returns true, e.g. those a
+// changed classification rule applies to, and returns how many it removed.
+// fn is called with the entry's key (an IP or a SetPrefix network) while its
+// shard is locked and must not use the cache.
+func (c *Cache) RemoveFunc(fn func(key string, info *model.IPInfo) bool) int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for key, e := range s.items {
+			if fn(key, e.data) {
+				s.remove(e)
+				n++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Clear removes all entries, e.g. after classification rules changed.
+func (c *Cache) Clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.items = make(map[string]*entry)
+		s.lru.Init()
+		s.expiry.Init()
+		s.bytes = 0
+		s.mu.Unlock()
 	}
 }
 
 func (c *Cache) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return len(c.items)
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += len(s.items)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Stats returns the current size and the counters.
+func (c *Cache) Stats() Stats {
+	var st Stats
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		st.Entries += len(s.items)
+		st.Bytes += s.bytes
+		st.Hits += s.hits.Load()
+		st.PrefixHits += s.prefixHits.Load()
+		st.Misses += s.misses.Load()
+		st.Evictions += s.evictions
+		s.mu.Unlock()
+	}
+	return st
 }
 
 func (c *Cache) TTL() time.Duration {
 	return c.ttl
 }
 
+// MaxEntries returns the entry limit, 0 if unlimited.
+func (c *Cache) MaxEntries() int {
+	return c.maxEntries
+}
+
+// MaxBytes returns the memory budget, 0 if unlimited.
+func (c *Cache) MaxBytes() int64 {
+	return c.maxBytes
+}
+
+// Shards returns the number of lock stripes.
+func (c *Cache) Shards() int {
+	return len(c.shards)
+}
+
 func (c *Cache) Stop() {
 	close(c.stopCh)
 }
 
 func (c *Cache) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(sweepInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			c.mu.Lock()
-			now := time.Now()
-			for k, v := range c.items {
-				if now.After(v.expiresAt) {
-					delete(c.items, k)
-				}
-			}
-			c.mu.Unlock()
+		case now := <-ticker.C:
+			c.sweep(now)
 		case <-c.stopCh:
 			return
 		}
 	}
 }
+
+// sweep removes the entries expired at now, releasing each shard's lock
+// between batches.
+func (c *Cache) sweep(now time.Time) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		for more := true; more; {
+			s.mu.Lock()
+			more = s.expire(now, c.sweepBatch)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Rough per-entry overheads used by entrySize: the entry with its list
+// elements and map slot, the IPInfo struct, one map entry of Provenance or
+// Confidence, and the Consensus struct.
+const (
+	entryOverhead    = 240
+	ipInfoSize       = 400
+	mapEntryOverhead = 48
+	consensusSize    = 64
+)
+
+// entrySize estimates the memory held by one cache entry.
+func entrySize(key string, info *model.IPInfo) int64 {
+	n := entryOverhead + ipInfoSize + len(key) +
+		len(info.IP) + len(info.EmbeddedIPv4) + len(info.ReservedType) +
+		len(info.ASNOrg) + len(info.ISP) + len(info.Hostname) +
+		len(info.UsageType) + len(info.CloudService) +
+		len(info.Country) + len(info.CountryCode) + len(info.City) +
+		len(info.Region) + len(info.Timezone) + len(info.Source)
+	for k, v := range info.Provenance {
+		n += mapEntryOverhead + len(k) + len(v)
+	}
+	for k := range info.Confidence {
+		n += mapEntryOverhead + len(k) + 8
+	}
+	if info.Consensus != nil {
+		n += consensusSize + len(info.Consensus.Flags)*mapEntryOverhead
+		for _, p := range info.Consensus.Providers {
+			n += 16 + len(p)
+		}
+	}
+	return int64(n)
+}
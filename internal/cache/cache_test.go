@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func newTestCache(t *testing.T, ttl time.Duration, maxEntries int, maxBytes int64) *Cache {
+	t.Helper()
+	c := New(ttl, maxEntries, maxBytes)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTestCache(t, time.Hour, 3, 0)
+	for i := 1; i <= 3; i++ {
+		ip := fmt.Sprintf("93.184.100.%d", i)
+		c.Set(ip, &model.IPInfo{IP: ip})
+	}
+	// .1 becomes the most recently used, .2 the oldest
+	if _, ok := c.Get("93.184.100.1"); !ok {
+		t.Fatal("93.184.100.1 missing")
+	}
+	c.Set("93.184.100.4", &model.IPInfo{IP: "93.184.100.4"})
+
+	if _, ok := c.Get("93.184.100.2"); ok {
+		t.Error("93.184.100.2 should have been evicted")
+	}
+	for _, ip := range []string{"93.184.100.1", "93.184.100.3", "93.184.100.4"} {
+		if _, ok := c.Get(ip); !ok {
+			t.Errorf("%s evicted", ip)
+		}
+	}
+
+	st := c.Stats()
+	if st.Entries != 3 || st.Evictions != 1 || st.Hits != 4 || st.Misses != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestCacheMemoryBudget(t *testing.T) {
+	info := &model.IPInfo{IP: "93.184.100.1", ASNOrg: "Example Networks", Provenance: map[string]string{"asn": "mmdb"}}
+	size := entrySize(info.IP, info)
+	c := newTestCache(t, time.Hour, 0, 2*size)
+
+	for i := 1; i <= 5; i++ {
+		c.Set(fmt.Sprintf("93.184.100.%d", i), info)
+	}
+	st := c.Stats()
+	if st.Entries != 2 || st.Bytes > 2*size || st.Evictions != 3 {
+		t.Fatalf("stats = %+v, entry size %d", st, size)
+	}
+
+	// Replacing an entry updates the accounting instead of adding to it
+	c.Set("93.184.100.5", info)
+	if st := c.Stats(); st.Entries != 2 || st.Bytes > 2*size {
+		t.Fatalf("after replace: %+v", st)
+	}
+
+	c.Clear()
+	if st := c.Stats(); st.Entries != 0 || st.Bytes != 0 {
+		t.Fatalf("after clear: %+v", st)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := newTestCache(t, 10*time.Millisecond, 0, 0)
+	c.Set("93.184.100.1", &model.IPInfo{IP: "93.184.100.1"})
+	if info, ok := c.Peek("93.184.100.1"); !ok || !info.Cached {
+		t.Fatal("fresh entry missing")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("93.184.100.1"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if st := c.Stats(); st.Entries != 0 || st.Hits != 0 || st.Misses != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	for _, tc := range []struct {
+		maxEntries int
+		maxBytes   int64
+		want       int
+	}{
+		{0, 0, maxShards},
+		{1000000, 0, maxShards},
+		{3, 0, 1},
+		{40000, 0, 32},
+		{0, 16 << 20, 16},
+		{1000000, 4 << 20, 4},
+	} {
+		if got := shardCount(tc.maxEntries, tc.maxBytes); got != tc.want {
+			t.Errorf("shardCount(%d, %d) = %d, want %d", tc.maxEntries, tc.maxBytes, got, tc.want)
+		}
+	}
+}
+
+func TestCacheShardedLimits(t *testing.T) {
+	c := newTestCache(t, time.Hour, 64*minShardEntries, 0)
+	if c.Shards() != maxShards {
+		t.Fatalf("shards = %d", c.Shards())
+	}
+	for i := 0; i < 2*c.MaxEntries(); i++ {
+		c.Set(testIP(i), &model.IPInfo{})
+	}
+	// Each shard evicts on its own, so the total stays within the limit
+	// plus rounding
+	if st := c.Stats(); st.Entries > c.MaxEntries() || st.Entries < c.MaxEntries()*9/10 {
+		t.Fatalf("entries = %d, limit %d", st.Entries, c.MaxEntries())
+	}
+}
+
+func TestCacheSweepIsIncremental(t *testing.T) {
+	c := newSharded(time.Hour, 1, 0, 0, 2)
+	c.Stop()
+	for i := 0; i < 5; i++ {
+		c.Set(testIP(i), &model.IPInfo{})
+	}
+	cutoff := time.Now().Add(time.Hour)
+	time.Sleep(time.Millisecond)
+	c.Set(testIP(1), &model.IPInfo{}) // refreshed, expires after cutoff
+
+	s := &c.shards[0]
+	if more := s.expire(cutoff, 2); !more || len(s.items) != 3 {
+		t.Fatalf("first batch: more=%v entries=%d", more, len(s.items))
+	}
+	c.sweep(cutoff)
+	if _, ok := c.Peek(testIP(1)); !ok || c.Size() != 1 {
+		t.Fatalf("after sweep: %d entries", c.Size())
+	}
+}
+
+func testIP(i int) string {
+	return fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+}
+
+// The benchmarks compare a single lock (shards=1) with the default striping.
+// Run with -cpu 1,4,16 to see the effect of contention.
+
+func benchmarkParallel(b *testing.B, shards int, setEvery int) {
+	const keys = 1 << 16
+	c := newSharded(time.Hour, shards, 0, 0, sweepBatch)
+	defer c.Stop()
+	info := &model.IPInfo{ASN: 64500, ASNOrg: "Example Networks"}
+	ips := make([]string, keys)
+	for i := range ips {
+		ips[i] = testIP(i)
+		c.Set(ips[i], info)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.IntN(keys)
+		for n := 1; pb.Next(); n++ {
+			i = (i + 7919) % keys
+			if setEvery > 0 && n%setEvery == 0 {
+				c.Set(ips[i], info)
+			} else {
+				c.Get(ips[i])
+			}
+		}
+	})
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	for _, shards := range []int{1, maxShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) { benchmarkParallel(b, shards, 0) })
+	}
+}
+
+func BenchmarkMixedParallel(b *testing.B) {
+	for _, shards := range []int{1, maxShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) { benchmarkParallel(b, shards, 10) })
+	}
+}
+
+// BenchmarkGetDuringSweep measures Get latency while a sweep removes one
+// million expired entries. "global" emulates the previous design, one lock
+// held for the whole sweep; "incremental" is the default. Compare the
+// reported p99 and max latencies.
+func BenchmarkGetDuringSweep(b *testing.B) {
+	for _, tc := range []struct {
+		name          string
+		shards, batch int
+	}{
+		{"global", 1, 0},
+		{"incremental", maxShards, sweepBatch},
+	} {
+		b.Run(tc.name, func(b *testing.B) { benchmarkGetDuringSweep(b, tc.shards, tc.batch) })
+	}
+}
+
+func benchmarkGetDuringSweep(b *testing.B, shards, batch int) {
+	const expired, live = 1 << 20, 1 << 10
+	info := &model.IPInfo{ASN: 64500}
+	var latencies []time.Duration
+
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		c := newSharded(time.Hour, shards, 0, 0, batch)
+		c.Stop()
+		for i := 0; i < expired; i++ {
+			c.Set(testIP(i), info)
+		}
+		cutoff := time.Now().Add(time.Hour)
+		time.Sleep(time.Millisecond)
+		liveIPs := make([]string, live)
+		for i := range liveIPs {
+			liveIPs[i] = fmt.Sprintf("93.184.%d.%d", i>>8, i&0xff)
+			c.Set(liveIPs[i], info)
+		}
+		b.StartTimer()
+
+		done := make(chan struct{})
+		go func() {
+			c.sweep(cutoff)
+			close(done)
+		}()
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var local []time.Duration
+				for i := rand.IntN(live); ; i = (i + 1) % live {
+					select {
+					case <-done:
+						mu.Lock()
+						latencies = append(latencies, local...)
+						mu.Unlock()
+						return
+					default:
+					}
+					start := time.Now()
+					c.Get(liveIPs[i])
+					local = append(local, time.Since(start))
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	slices.Sort(latencies)
+	if len(latencies) > 0 {
+		b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		b.ReportMetric(float64(latencies[len(latencies)-1].Nanoseconds()), "max-ns")
+	}
+}
+
+func TestCachePrefixEntries(t *testing.T) {
+	c := newTestCache(t, time.Hour, 0, 0)
+	p := netip.MustParsePrefix("2a01:db8:1:2::/64")
+	c.SetPrefix(netip.MustParsePrefix("2a01:db8:1:2::1/64"), &model.IPInfo{IP: "2a01:db8:1:2::1", ASN: 64500})
+	c.Set("2a01:db8:1:2::5", &model.IPInfo{IP: "2a01:db8:1:2::5", ASN: 64501})
+
+	info, hit, ok := c.GetPrefix("2a01:db8:1:2::9", p)
+	if !ok || !hit.Shared || info.IP != "2a01:db8:1:2::9" || info.ASN != 64500 {
+		t.Fatalf("shared entry: %+v, %+v ok=%v", info, hit, ok)
+	}
+	// An entry of its own wins
+	if info, hit, ok = c.GetPrefix("2a01:db8:1:2::5", p); !ok || hit.Shared || info.ASN != 64501 {
+		t.Fatalf("own entry: %+v, %+v ok=%v", info, hit, ok)
+	}
+	if _, _, ok = c.GetPrefix("2a01:db8:1:3::1", netip.MustParsePrefix("2a01:db8:1:3::/64")); ok {
+		t.Fatal("other prefix answered")
+	}
+	if _, _, ok = c.GetPrefix("2a01:db8:1:2::9", netip.Prefix{}); ok {
+		t.Fatal("answered with prefix caching disabled")
+	}
+
+	if st := c.Stats(); st.Hits != 2 || st.PrefixHits != 1 || st.Misses != 2 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestCacheHot(t *testing.T) {
+	c := newTestCache(t, time.Hour, 0, 0)
+	for _, ip := range []string{"93.184.100.1", "93.184.100.2", "93.184.100.3"} {
+		c.Set(ip, &model.IPInfo{IP: ip})
+	}
+	for i := 0; i < 3; i++ {
+		c.Get("93.184.100.2")
+	}
+	c.Get("93.184.100.3")
+
+	if keys := c.Hot(time.Now().Add(2*time.Hour), 2, 10); len(keys) != 1 || keys[0] != "93.184.100.2" {
+		t.Fatalf("hot = %v", keys)
+	}
+	if keys := c.Hot(time.Now(), 1, 10); len(keys) != 0 {
+		t.Fatalf("hot before deadline = %v", keys)
+	}
+
+	// Storing a new result restarts the count and the age
+	c.Set("93.184.100.2", &model.IPInfo{IP: "93.184.100.2"})
+	if keys := c.Hot(time.Now().Add(2*time.Hour), 2, 10); len(keys) != 0 {
+		t.Fatalf("hot after set = %v", keys)
+	}
+	if _, hit, ok := c.GetPrefix("93.184.100.2", netip.Prefix{}); !ok || hit.Age > time.Second {
+		t.Fatalf("age = %v", hit.Age)
+	}
+}
+
+func TestCacheHotSoonestAcrossShards(t *testing.T) {
+	c := newTestCache(t, time.Hour, 0, 0)
+	var ips []string
+	for i := 1; i <= 20; i++ {
+		ip := fmt.Sprintf("93.184.100.%d", i)
+		ips = append(ips, ip)
+		c.Set(ip, &model.IPInfo{IP: ip})
+		c.Get(ip)
+		time.Sleep(time.Millisecond)
+	}
+
+	keys := c.Hot(time.Now().Add(2*time.Hour), 1, 3)
+	if !slices.Equal(keys, ips[:3]) {
+		t.Fatalf("hot = %v, want %v", keys, ips[:3])
+	}
+}
+
+func TestCacheGetCopiesMaps(t *testing.T) {
+	c := newTestCache(t, time.Hour, 0, 0)
+	c.Set("93.184.100.1", &model.IPInfo{
+		IP:         "93.184.100.1",
+		Provenance: map[string]string{"is_datacenter": "mmdb"},
+		Confidence: map[string]float64{"is_datacenter": 0.5},
+	})
+
+	got, _ := c.Get("93.184.100.1")
+	got.Provenance["is_datacenter"] = "override"
+	got.Confidence["is_datacenter"] = 1
+
+	again, _ := c.Get("93.184.100.1")
+	if again.Provenance["is_datacenter"] != "mmdb" || again.Confidence["is_datacenter"] != 0.5 {
+		t.Fatalf("stored entry modified through a copy: %v %v", again.Provenance, again.Confidence)
+	}
+}
+
+func TestCacheRemoveFunc(t *testing.T) {
+	c := newTestCache(t, time.Hour, 0, 0)
+	c.Set("93.184.100.1", &model.IPInfo{IP: "93.184.100.1", ASN: 64500})
+	c.Set("93.184.100.2", &model.IPInfo{IP: "93.184.100.2", ASN: 64501})
+	c.SetPrefix(netip.MustParsePrefix("93.184.100.0/24"), &model.IPInfo{ASN: 64500})
+
+	n := c.RemoveFunc(func(_ string, info *model.IPInfo) bool { return info.ASN == 64500 })
+	if n != 2 {
+		t.Fatalf("removed %d entries, want 2", n)
+	}
+	if st := c.Stats(); st.Entries != 1 {
+		t.Fatalf("entries = %d, want 1", st.Entries)
+	}
+	if _, ok := c.Peek("93.184.100.2"); !ok {
+		t.Fatal("non-matching entry removed")
+	}
+}
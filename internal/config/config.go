@@ -13,10 +13,31 @@ type Config struct {
 	Host string
 
 	// Auth
-	AuthKey string // Bearer token for authentication, empty = no auth
+	AuthKey  string // Bearer token for authentication, empty = no auth
+	AdminKey string // Bearer token for /-/admin/ endpoints, defaults to AuthKey, empty = admin API disabled
+
+	// Batch lookups
+	BatchMaxSize     int // max IPs accepted in one POST /batch request
+	BatchConcurrency int // max lookups running in parallel for one batch
 
 	// Cache
-	CacheTTL time.Duration
+	CacheTTL        time.Duration
+	CacheMaxEntries int   // LRU eviction above this many entries, 0 = unlimited
+	CacheMaxBytes   int64 // LRU eviction above this estimated memory use, 0 = unlimited
+	CachePrefixV4   int   // share results decided by the ASN within IPv4 networks of this length, 0 = off
+	CachePrefixV6   int   // share all results within IPv6 networks of this length (e.g. 64), 0 = off
+
+	// Negative cache: lookups no provider answered are not retried for this long, 0 = off
+	NegativeCacheTTL time.Duration
+
+	// Stale-while-revalidate: older entries are served and renewed in the background
+	CacheSoftTTL           time.Duration // 0 = off
+	PersistentCacheSoftTTL time.Duration // 0 = off
+	CacheRefreshHotHits    int           // renew entries read this often before they expire, 0 = off
+	CacheRefreshInterval   time.Duration // how often to look for hot entries about to expire
+
+	// Lookup
+	LookupTimeout time.Duration // overall deadline for one lookup, including all provider calls
 
 	// Persistent cache (SQLite or MySQL)
 	PersistentCache     bool
@@ -25,7 +46,33 @@ type Config struct {
 	PersistentCacheTTL  time.Duration
 
 	// Local database
-	MMDBPath string
+	MMDBPath           string
+	MMDBGeoPaths       []string      // extra City/Country MMDB files for offline geolocation, first match wins
+	MMDBReloadInterval time.Duration // how often to check the MMDB file for changes, 0 = never
+
+	// ASN lists: files merged over the built-in datacenter/residential lists
+	ASNListFiles          []string
+	ASNListReloadInterval time.Duration // how often to check the files for changes, 0 = never
+
+	// Published cloud IP ranges: files, each "path" or "name=path"; they take precedence over the ASN lists
+	CloudRangeFiles          []string
+	CloudRangeReloadInterval time.Duration // how often to check the files for changes, 0 = never
+
+	// Organization-name scoring for ASNs missing from the ASN lists
+	OrgNameRulesFile    string  // extra "<weight> <regexp>" rules appended to the built-in ones, empty = none
+	OrgHostingThreshold float64 // hosting likelihood needed to answer locally, in (0.5, 1]; 1 = disabled
+
+	// Reverse DNS
+	RDNSEnabled  bool
+	RDNSResolver string        // "host" or "host:port" of the DNS server for PTR lookups, empty = system resolver
+	RDNSTimeout  time.Duration // deadline for one PTR lookup
+
+	// Bogon lists: plain CIDR files (e.g. Team Cymru fullbogons) treated like reserved ranges
+	BogonFiles []string
+
+	// Tor exit list: file path or http(s) URL of a bulk exit list or Onionoo document, empty = disabled
+	TorExitList        string
+	TorExitListRefresh time.Duration // how often to reload the list, 0 = never
 
 	// Provider API keys
 	IPInfoToken  string
@@ -33,6 +80,21 @@ type Config struct {
 
 	// Provider control
 	EnabledProviders []string
+	ProvidersFile    string // JSON file with declarative HTTP/JSON providers, empty = none
+
+	// Quota overrides per provider name, 0 = unlimited
+	ProviderDailyQuotas   map[string]int
+	ProviderMonthlyQuotas map[string]int
+
+	// Circuit breaker per provider
+	BreakerFailures    int           // consecutive failures that open the breaker, 0 = disabled
+	BreakerCooldown    time.Duration // first open period, doubled on each failed probe
+	BreakerMaxCooldown time.Duration // upper bound for the open period
+
+	// Consensus mode: query several providers concurrently and vote per flag.
+	ConsensusProviders int                // number of providers to query, <= 1 = first success wins
+	ConsensusQuorum    float64            // weighted share of "true" votes a flag must exceed
+	ProviderWeights    map[string]float64 // vote weight per provider name, default 1
 }
 
 func Load() *Config {
@@ -40,9 +102,43 @@ func Load() *Config {
 		Port:     envOrDefault("PORT", "9090"),
 		Host:     envOrDefault("HOST", "0.0.0.0"),
 		AuthKey:  os.Getenv("AUTH_KEY"),
+		AdminKey: envOrDefault("ADMIN_KEY", os.Getenv("AUTH_KEY")),
 		CacheTTL: envDurationOrDefault("CACHE_TTL_HOURS", 6) * time.Hour,
 		MMDBPath: envOrDefault("MMDB_PATH", "data/GeoLite2-ASN.mmdb"),
 
+		CacheMaxEntries: envIntOrDefault("CACHE_MAX_ENTRIES", 1000000),
+		CacheMaxBytes:   int64(envIntOrDefault("CACHE_MAX_MEMORY_MB", 0)) << 20,
+		CachePrefixV4:   envIntOrDefault("CACHE_PREFIX_V4", 0),
+		CachePrefixV6:   envIntOrDefault("CACHE_PREFIX_V6", 0),
+
+		NegativeCacheTTL: envDurationOrDefault("NEGATIVE_CACHE_TTL_SECONDS", 60) * time.Second,
+
+		CacheSoftTTL:           envDurationOrDefault("CACHE_SOFT_TTL_MINUTES", 0) * time.Minute,
+		PersistentCacheSoftTTL: envDurationOrDefault("PERSISTENT_CACHE_SOFT_TTL_DAYS", 0) * 24 * time.Hour,
+		CacheRefreshHotHits:    envIntOrDefault("CACHE_REFRESH_HOT_HITS", 0),
+		CacheRefreshInterval:   envDurationOrDefault("CACHE_REFRESH_INTERVAL_SECONDS", 60) * time.Second,
+
+		MMDBReloadInterval: envDurationOrDefault("MMDB_RELOAD_INTERVAL_SECONDS", 60) * time.Second,
+
+		ASNListReloadInterval: envDurationOrDefault("ASN_LIST_RELOAD_INTERVAL_SECONDS", 60) * time.Second,
+
+		CloudRangeReloadInterval: envDurationOrDefault("CLOUD_RANGE_RELOAD_INTERVAL_SECONDS", 60) * time.Second,
+
+		OrgNameRulesFile:    os.Getenv("ORG_NAME_RULES_FILE"),
+		OrgHostingThreshold: envFloatOrDefault("ORG_HOSTING_THRESHOLD", 1),
+
+		RDNSEnabled:  envBool("RDNS_ENABLED", false),
+		RDNSResolver: os.Getenv("RDNS_RESOLVER"),
+		RDNSTimeout:  envDurationOrDefault("RDNS_TIMEOUT_MS", 500) * time.Millisecond,
+
+		TorExitList:        os.Getenv("TOR_EXIT_LIST"),
+		TorExitListRefresh: envDurationOrDefault("TOR_EXIT_LIST_REFRESH_MINUTES", 30) * time.Minute,
+
+		LookupTimeout: envDurationOrDefault("LOOKUP_TIMEOUT_SECONDS", 10) * time.Second,
+
+		BatchMaxSize:     envIntOrDefault("BATCH_MAX_SIZE", 1000),
+		BatchConcurrency: envIntOrDefault("BATCH_CONCURRENCY", 8),
+
 		PersistentCache:     envBool("PERSISTENT_CACHE", false),
 		PersistentCacheType: envOrDefault("PERSISTENT_CACHE_TYPE", "sqlite"),
 		PersistentCacheDSN:  envOrDefault("PERSISTENT_CACHE_DSN", "data/ip-cache.db"),
@@ -50,11 +146,27 @@ func Load() *Config {
 
 		IPInfoToken:  os.Getenv("IPINFO_TOKEN"),
 		IPDataAPIKey: os.Getenv("IPDATA_API_KEY"),
+
+		ProvidersFile:         os.Getenv("PROVIDERS_FILE"),
+		ProviderDailyQuotas:   parseCounts(os.Getenv("PROVIDER_DAILY_QUOTAS")),
+		ProviderMonthlyQuotas: parseCounts(os.Getenv("PROVIDER_MONTHLY_QUOTAS")),
+
+		BreakerFailures:    envIntOrDefault("BREAKER_FAILURES", 3),
+		BreakerCooldown:    envDurationOrDefault("BREAKER_COOLDOWN_SECONDS", 30) * time.Second,
+		BreakerMaxCooldown: envDurationOrDefault("BREAKER_MAX_COOLDOWN_SECONDS", 600) * time.Second,
+
+		ConsensusProviders: envIntOrDefault("CONSENSUS_PROVIDERS", 0),
+		ConsensusQuorum:    envFloatOrDefault("CONSENSUS_QUORUM", 0.5),
+		ProviderWeights:    parseWeights(os.Getenv("PROVIDER_WEIGHTS")),
 	}
 
 	if providers := os.Getenv("ENABLED_PROVIDERS"); providers != "" {
 		cfg.EnabledProviders = strings.Split(providers, ",")
 	}
+	cfg.MMDBGeoPaths = parseList(os.Getenv("MMDB_GEO_PATHS"))
+	cfg.ASNListFiles = parseList(os.Getenv("ASN_LIST_FILES"))
+	cfg.CloudRangeFiles = parseList(os.Getenv("CLOUD_RANGE_FILES"))
+	cfg.BogonFiles = parseList(os.Getenv("BOGON_FILES"))
 
 	return cfg
 }
@@ -75,6 +187,67 @@ func envDurationOrDefault(key string, def int) time.Duration {
 	return time.Duration(def)
 }
 
+func envIntOrDefault(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return def
+}
+
+func envFloatOrDefault(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// parseWeights parses "name=weight,name=weight" into a map.
+// Malformed entries are ignored.
+func parseWeights(s string) map[string]float64 {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if w, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			weights[strings.TrimSpace(name)] = w
+		}
+	}
+	return weights
+}
+
+// parseList parses a comma-separated list, dropping empty items.
+func parseList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseCounts parses "name=count,name=count" into a map.
+// Malformed entries are ignored.
+func parseCounts(s string) map[string]int {
+	counts := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			counts[strings.TrimSpace(name)] = n
+		}
+	}
+	return counts
+}
+
 func envBool(key string, def bool) bool {
 	v := os.Getenv(key)
 	if v == "" {
@@ -0,0 +1,314 @@
+// Package iptrie implements a path-compressed binary trie of IPv4 and IPv6
+// prefixes with longest-prefix matching. Each prefix carries a value of
+// type V, e.g. a classification tag.
+//
+// A Trie is not safe for concurrent use while it is being modified.
+// Concurrent lookups without writers are safe, so a trie built once and then
+// only read (or swapped as a whole) needs no locking.
+package iptrie
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+)
+
+// key is an address as a 128-bit big-endian integer. IPv4 addresses occupy
+// the top 32 bits.
+type key struct {
+	hi, lo uint64
+}
+
+func keyOf(addr netip.Addr) key {
+	if addr.Is4() {
+		a := addr.As4()
+		return key{hi: uint64(binary.BigEndian.Uint32(a[:])) << 32}
+	}
+	a := addr.As16()
+	return key{hi: binary.BigEndian.Uint64(a[:8]), lo: binary.BigEndian.Uint64(a[8:])}
+}
+
+// bit returns bit i counted from the most significant bit.
+func (k key) bit(i int) int {
+	if i < 64 {
+		return int(k.hi >> (63 - i) & 1)
+	}
+	return int(k.lo >> (127 - i) & 1)
+}
+
+// commonBits returns the length of the common prefix of a and b, at most limit.
+func commonBits(a, b key, limit int) int {
+	n := bits.LeadingZeros64(a.hi ^ b.hi)
+	if n == 64 {
+		n += bits.LeadingZeros64(a.lo ^ b.lo)
+	}
+	if n > limit {
+		return limit
+	}
+	return n
+}
+
+// mask clears all bits after the first n.
+func (k key) mask(n int) key {
+	switch {
+	case n == 0:
+		return key{}
+	case n < 64:
+		return key{hi: k.hi &^ (1<<(64-n) - 1)}
+	case n == 64:
+		return key{hi: k.hi}
+	case n < 128:
+		return key{hi: k.hi, lo: k.lo &^ (1<<(128-n) - 1)}
+	}
+	return k
+}
+
+type node[V any] struct {
+	key      key
+	bits     int
+	children [2]*node[V]
+	value    V
+	set      bool // whether the prefix itself was inserted, or the node only branches
+}
+
+// Trie maps prefixes to values. The zero value is an empty trie.
+type Trie[V any] struct {
+	v4, v6 *node[V]
+	n      int
+}
+
+// New returns an empty trie.
+func New[V any]() *Trie[V] {
+	return &Trie[V]{}
+}
+
+// normalize masks p and turns IPv4-mapped IPv6 prefixes into IPv4 prefixes.
+func normalize(p netip.Prefix) (netip.Prefix, bool) {
+	if !p.IsValid() {
+		return p, false
+	}
+	if p.Addr().Is4In6() {
+		if p.Bits() < 96 {
+			return p.Masked(), true
+		}
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), true
+}
+
+func (t *Trie[V]) root(addr netip.Addr) **node[V] {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// Len returns the number of prefixes in the trie.
+func (t *Trie[V]) Len() int {
+	return t.n
+}
+
+// Insert sets the value of prefix p, replacing any previous value. p is
+// masked first; invalid prefixes are ignored.
+func (t *Trie[V]) Insert(p netip.Prefix, value V) {
+	p, ok := normalize(p)
+	if !ok {
+		return
+	}
+	k, plen := keyOf(p.Addr()), p.Bits()
+	leaf := &node[V]{key: k, bits: plen, value: value, set: true}
+
+	n := t.root(p.Addr())
+	for {
+		cur := *n
+		if cur == nil {
+			*n = leaf
+			t.n++
+			return
+		}
+		common := commonBits(cur.key, k, min(cur.bits, plen))
+		if common == cur.bits {
+			if plen == cur.bits {
+				if !cur.set {
+					t.n++
+				}
+				cur.value, cur.set = value, true
+				return
+			}
+			n = &cur.children[k.bit(cur.bits)]
+			continue
+		}
+		if common == plen {
+			// p is an ancestor of cur
+			leaf.children[cur.key.bit(plen)] = cur
+			*n = leaf
+			t.n++
+			return
+		}
+		branch := &node[V]{key: k.mask(common), bits: common}
+		branch.children[k.bit(common)] = leaf
+		branch.children[cur.key.bit(common)] = cur
+		*n = branch
+		t.n++
+		return
+	}
+}
+
+// Get returns the value stored for exactly prefix p.
+func (t *Trie[V]) Get(p netip.Prefix) (V, bool) {
+	var zero V
+	p, ok := normalize(p)
+	if !ok {
+		return zero, false
+	}
+	k, plen := keyOf(p.Addr()), p.Bits()
+	for n := *t.root(p.Addr()); n != nil && n.bits <= plen; n = n.children[k.bit(n.bits)] {
+		if commonBits(n.key, k, n.bits) < n.bits {
+			break
+		}
+		if n.bits == plen {
+			if n.set {
+				return n.value, true
+			}
+			break
+		}
+	}
+	return zero, false
+}
+
+// Lookup returns the longest prefix containing addr and its value.
+// IPv4-mapped IPv6 addresses are matched as IPv4.
+func (t *Trie[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	var (
+		zero V
+		best *node[V]
+	)
+	if !addr.IsValid() {
+		return netip.Prefix{}, zero, false
+	}
+	addr = addr.Unmap()
+	k, width := keyOf(addr), addr.BitLen()
+	for n := *t.root(addr); n != nil; n = n.children[k.bit(n.bits)] {
+		if commonBits(n.key, k, n.bits) < n.bits {
+			break
+		}
+		if n.set {
+			best = n
+		}
+		if n.bits == width {
+			break
+		}
+	}
+	if best == nil {
+		return netip.Prefix{}, zero, false
+	}
+	return prefixOf(addr, best.bits), best.value, true
+}
+
+// Contains reports whether any prefix in the trie contains addr.
+func (t *Trie[V]) Contains(addr netip.Addr) bool {
+	_, _, ok := t.Lookup(addr)
+	return ok
+}
+
+func prefixOf(addr netip.Addr, bits int) netip.Prefix {
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// Delete removes prefix p and reports whether it was present.
+func (t *Trie[V]) Delete(p netip.Prefix) bool {
+	p, ok := normalize(p)
+	if !ok {
+		return false
+	}
+	k, plen := keyOf(p.Addr()), p.Bits()
+
+	var parent **node[V]
+	n := t.root(p.Addr())
+	for *n != nil && (*n).bits < plen {
+		if commonBits((*n).key, k, (*n).bits) < (*n).bits {
+			return false
+		}
+		parent, n = n, &(*n).children[k.bit((*n).bits)]
+	}
+	cur := *n
+	if cur == nil || cur.bits != plen || !cur.set || commonBits(cur.key, k, plen) < plen {
+		return false
+	}
+
+	var zero V
+	cur.value, cur.set = zero, false
+	t.n--
+	*n = compact(cur)
+	if parent != nil {
+		*parent = compact(*parent)
+	}
+	return true
+}
+
+// compact removes n if it holds no prefix and has fewer than two children.
+func compact[V any](n *node[V]) *node[V] {
+	if n.set {
+		return n
+	}
+	switch {
+	case n.children[0] == nil:
+		return n.children[1]
+	case n.children[1] == nil:
+		return n.children[0]
+	}
+	return n
+}
+
+// Walk calls fn for every prefix in the trie, IPv4 before IPv6 and in
+// address order within a family, shorter prefixes before longer ones
+// covered by them. Walk stops when fn returns false.
+func (t *Trie[V]) Walk(fn func(netip.Prefix, V) bool) {
+	if walk(t.v4, true, fn) {
+		walk(t.v6, false, fn)
+	}
+}
+
+// WalkWithin is Walk restricted to the prefixes contained in p, including p
+// itself. It visits only the subtree below p, so its cost does not grow with
+// the prefixes elsewhere in the trie.
+func (t *Trie[V]) WalkWithin(p netip.Prefix, fn func(netip.Prefix, V) bool) {
+	p, ok := normalize(p)
+	if !ok {
+		return
+	}
+	k, plen := keyOf(p.Addr()), p.Bits()
+	n := *t.root(p.Addr())
+	for n != nil && n.bits < plen {
+		if commonBits(n.key, k, n.bits) < n.bits {
+			return
+		}
+		n = n.children[k.bit(n.bits)]
+	}
+	if n != nil && commonBits(n.key, k, plen) == plen {
+		walk(n, p.Addr().Is4(), fn)
+	}
+}
+
+func walk[V any](n *node[V], is4 bool, fn func(netip.Prefix, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.set && !fn(n.prefix(is4), n.value) {
+		return false
+	}
+	return walk(n.children[0], is4, fn) && walk(n.children[1], is4, fn)
+}
+
+func (n *node[V]) prefix(is4 bool) netip.Prefix {
+	if is4 {
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], uint32(n.key.hi>>32))
+		return netip.PrefixFrom(netip.AddrFrom4(a), n.bits)
+	}
+	var a [16]byte
+	binary.BigEndian.PutUint64(a[:8], n.key.hi)
+	binary.BigEndian.PutUint64(a[8:], n.key.lo)
+	return netip.PrefixFrom(netip.AddrFrom16(a), n.bits)
+}
@@ -0,0 +1,271 @@
+package iptrie
+
+import (
+	"math/rand"
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestLookupLongestPrefix(t *testing.T) {
+	tr := New[string]()
+	for p, v := range map[string]string{
+		"10.0.0.0/8":      "ten",
+		"10.1.0.0/16":     "ten-one",
+		"10.1.2.0/24":     "ten-one-two",
+		"0.0.0.0/0":       "default",
+		"2001:db8::/32":   "doc",
+		"2001:db8:1::/48": "doc-one",
+		"::1/128":         "loopback",
+	} {
+		tr.Insert(netip.MustParsePrefix(p), v)
+	}
+	if tr.Len() != 7 {
+		t.Fatalf("Len = %d, want 7", tr.Len())
+	}
+
+	for ip, want := range map[string]string{
+		"10.1.2.3":        "ten-one-two",
+		"10.1.3.3":        "ten-one",
+		"10.2.0.1":        "ten",
+		"192.0.2.1":       "default",
+		"::ffff:10.1.2.3": "ten-one-two",
+		"2001:db8:1::5":   "doc-one",
+		"2001:db8:2::5":   "doc",
+		"::1":             "loopback",
+	} {
+		_, got, ok := tr.Lookup(netip.MustParseAddr(ip))
+		if !ok || got != want {
+			t.Errorf("Lookup(%s) = %q, %v, want %q", ip, got, ok, want)
+		}
+	}
+	if tr.Contains(netip.MustParseAddr("2001:db9::1")) {
+		t.Error("2001:db9::1 should not match")
+	}
+	if p, _, _ := tr.Lookup(netip.MustParseAddr("10.1.3.3")); p != netip.MustParsePrefix("10.1.0.0/16") {
+		t.Errorf("matched prefix = %s", p)
+	}
+}
+
+func TestInsertMasksAndReplaces(t *testing.T) {
+	tr := New[int]()
+	tr.Insert(netip.MustParsePrefix("192.0.2.77/24"), 1)
+	tr.Insert(netip.MustParsePrefix("192.0.2.0/24"), 2)
+	tr.Insert(netip.MustParsePrefix("::ffff:198.51.100.0/120"), 3)
+	if tr.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", tr.Len())
+	}
+	if v, ok := tr.Get(netip.MustParsePrefix("192.0.2.0/24")); !ok || v != 2 {
+		t.Errorf("Get = %d, %v", v, ok)
+	}
+	if v, ok := tr.Get(netip.MustParsePrefix("198.51.100.0/24")); !ok || v != 3 {
+		t.Errorf("mapped prefix: Get = %d, %v", v, ok)
+	}
+	if _, ok := tr.Get(netip.MustParsePrefix("192.0.0.0/16")); ok {
+		t.Error("Get of a missing covering prefix should fail")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tr := New[int]()
+	prefixes := []string{"10.0.0.0/8", "10.1.0.0/16", "10.2.0.0/16", "10.1.1.0/24"}
+	for i, p := range prefixes {
+		tr.Insert(netip.MustParsePrefix(p), i)
+	}
+	if tr.Delete(netip.MustParsePrefix("10.3.0.0/16")) {
+		t.Error("deleted a missing prefix")
+	}
+	if !tr.Delete(netip.MustParsePrefix("10.1.0.0/16")) {
+		t.Fatal("delete failed")
+	}
+	if _, v, _ := tr.Lookup(netip.MustParseAddr("10.1.2.1")); v != 0 {
+		t.Errorf("after delete 10.1.2.1 → %d, want 0", v)
+	}
+	if _, v, _ := tr.Lookup(netip.MustParseAddr("10.1.1.1")); v != 3 {
+		t.Errorf("after delete 10.1.1.1 → %d, want 3", v)
+	}
+	for _, p := range prefixes {
+		tr.Delete(netip.MustParsePrefix(p))
+	}
+	if tr.Len() != 0 || tr.v4 != nil {
+		t.Fatalf("trie not empty: Len %d", tr.Len())
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	tr := New[int]()
+	for _, p := range []string{"2001:db8::/32", "10.1.0.0/16", "10.0.0.0/8", "9.0.0.0/8"} {
+		tr.Insert(netip.MustParsePrefix(p), 0)
+	}
+	var got []string
+	tr.Walk(func(p netip.Prefix, _ int) bool {
+		got = append(got, p.String())
+		return true
+	})
+	want := []string{"9.0.0.0/8", "10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32"}
+	if len(got) != len(want) {
+		t.Fatalf("Walk = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Walk = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestWalkWithin(t *testing.T) {
+	tr := New[int]()
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16", "11.0.0.0/8", "2001:db8::/32"} {
+		tr.Insert(netip.MustParsePrefix(p), 0)
+	}
+	for within, want := range map[string][]string{
+		"10.1.0.0/16":   {"10.1.0.0/16", "10.1.2.0/24"},
+		"10.0.0.0/12":   {"10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16"},
+		"10.1.2.128/25": nil,
+		"0.0.0.0/0":     {"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16", "11.0.0.0/8"},
+		"2001:db8::/16": {"2001:db8::/32"},
+		"12.0.0.0/8":    nil,
+	} {
+		var got []string
+		tr.WalkWithin(netip.MustParsePrefix(within), func(p netip.Prefix, _ int) bool {
+			got = append(got, p.String())
+			return true
+		})
+		if len(got) != len(want) {
+			t.Errorf("WalkWithin(%s) = %v, want %v", within, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("WalkWithin(%s) = %v, want %v", within, got, want)
+				break
+			}
+		}
+	}
+}
+
+// TestMatchesLinearScan compares the trie with a brute-force search.
+func TestMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rng, 2000, 4)
+	prefixes = append(prefixes, randomPrefixes(rng, 2000, 6)...)
+	tr := New[int]()
+	for i, p := range prefixes {
+		tr.Insert(p, i)
+	}
+
+	for i := 0; i < 20000; i++ {
+		var addr netip.Addr
+		if i%2 == 0 {
+			addr = randomAddr(rng, 4)
+		} else {
+			addr = randomAddr(rng, 6)
+		}
+		// Bias towards hits by reusing a stored prefix's address
+		if i%3 == 0 {
+			addr = prefixes[rng.Intn(len(prefixes))].Addr()
+		}
+
+		// Duplicate prefixes keep the last inserted value
+		want, bits := -1, -1
+		for j, p := range prefixes {
+			if p.Bits() >= bits && p.Contains(addr) {
+				want, bits = j, p.Bits()
+			}
+		}
+		_, got, ok := tr.Lookup(addr)
+		if !ok {
+			got = -1
+		}
+		if got != want {
+			t.Fatalf("Lookup(%s) = %d, want %d", addr, got, want)
+		}
+	}
+}
+
+func randomAddr(rng *rand.Rand, family int) netip.Addr {
+	if family == 4 {
+		var a [4]byte
+		rng.Read(a[:])
+		return netip.AddrFrom4(a)
+	}
+	var a [16]byte
+	rng.Read(a[:])
+	a[0] = 0x20 // stay in 2000::/8 so prefixes overlap
+	return netip.AddrFrom16(a)
+}
+
+func randomPrefixes(rng *rand.Rand, n, family int) []netip.Prefix {
+	out := make([]netip.Prefix, n)
+	for i := range out {
+		var bits int
+		if family == 4 {
+			bits = 8 + rng.Intn(25) // /8 to /32
+		} else {
+			bits = 16 + rng.Intn(49) // /16 to /64
+		}
+		out[i], _ = randomAddr(rng, family).Prefix(bits)
+	}
+	return out
+}
+
+const benchPrefixes = 1_000_000
+
+var (
+	benchOnce  sync.Once
+	benchTrie  *Trie[int]
+	benchAddrs []netip.Addr
+)
+
+// benchSetup builds a trie of a million IPv4 and a million IPv6 prefixes.
+func benchSetup() {
+	benchOnce.Do(func() {
+		rng := rand.New(rand.NewSource(42))
+		benchTrie = New[int]()
+		for i, p := range randomPrefixes(rng, benchPrefixes, 4) {
+			benchTrie.Insert(p, i)
+		}
+		for i, p := range randomPrefixes(rng, benchPrefixes, 6) {
+			benchTrie.Insert(p, i)
+		}
+		benchAddrs = make([]netip.Addr, 1<<16)
+		for i := range benchAddrs {
+			benchAddrs[i] = randomAddr(rng, 4+2*(i%2))
+		}
+	})
+}
+
+func BenchmarkInsert1M(b *testing.B) {
+	rng := rand.New(rand.NewSource(7))
+	prefixes := randomPrefixes(rng, benchPrefixes, 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr := New[int]()
+		for j, p := range prefixes {
+			tr.Insert(p, j)
+		}
+	}
+}
+
+func BenchmarkLookup1M(b *testing.B) {
+	benchSetup()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchTrie.Lookup(benchAddrs[i&(len(benchAddrs)-1)])
+	}
+}
+
+func BenchmarkLookup1MParallel(b *testing.B) {
+	benchSetup()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			benchTrie.Lookup(benchAddrs[i&(len(benchAddrs)-1)])
+			i++
+		}
+	})
+}
@@ -1,144 +1,206 @@
 package lookup
 
-// DatacenterASNs contains known datacenter/cloud/hosting provider ASNs.
-// Only includes providers that are indisputably hosting infrastructure.
+// UsageType classifies what an ASN's addresses are used for. It is exposed
+// as IPInfo.UsageType.
+type UsageType string
+
+const (
+	UsageCloud      UsageType = "cloud"      // public cloud platforms
+	UsageHosting    UsageType = "hosting"    // VPS, dedicated servers and colocation
+	UsageCDN        UsageType = "cdn"        // CDN and edge networks
+	UsageVPN        UsageType = "vpn"        // VPN operators
+	UsageMobile     UsageType = "mobile"     // mobile carriers
+	UsageISP        UsageType = "isp"        // fixed-line ISPs
+	UsageEducation  UsageType = "education"  // universities and research networks
+	UsageGovernment UsageType = "government" // government networks
+)
+
+// IsDatacenter reports whether addresses of this usage type are server
+// infrastructure rather than end users.
+func (u UsageType) IsDatacenter() bool {
+	switch u {
+	case UsageCloud, UsageHosting, UsageCDN, UsageVPN:
+		return true
+	}
+	return false
+}
+
+// IsResidential reports whether the usage type serves residential or mobile
+// end users, so that its addresses should never be classified as datacenter.
+func (u UsageType) IsResidential() bool {
+	return u == UsageMobile || u == UsageISP
+}
+
+// Valid reports whether u is a known usage type.
+func (u UsageType) Valid() bool {
+	return u.IsDatacenter() || u.IsResidential() || u == UsageEducation || u == UsageGovernment
+}
+
+// ASNEntry is a classified ASN.
+type ASNEntry struct {
+	Org   string
+	Usage UsageType
+}
+
+// KnownASNs contains classified ASNs. Datacenter usage types (cloud, hosting,
+// CDN, VPN) only include providers that are indisputably hosting
+// infrastructure. Mobile carriers and fixed-line ISPs serve massive
+// residential/mobile user bases; even if their org name contains "Cloud",
+// the vast majority of IPs are regular end-users (e.g. 4G/5G mobile), so they
+// are never classified as datacenter.
 // Source: public BGP data + official provider documentation.
-var DatacenterASNs = map[int]string{
+//
+// These are the built-in defaults; ASN_LIST_FILES can extend or override them
+// at runtime (see asn_source.go).
+var KnownASNs = map[int]ASNEntry{
 	// === Major Cloud Providers ===
-	16509:  "Amazon.com / AWS",
-	14618:  "Amazon.com / AWS",
-	8075:   "Microsoft Azure",
-	15169:  "Google Cloud",
-	396982: "Google Cloud",
-	45102:  "Alibaba Cloud",
-	45090:  "Tencent Cloud",
-	132203: "Tencent Cloud",
-	31898:  "Oracle Cloud",
-	36351:  "IBM Cloud / SoftLayer",
-	13335:  "Cloudflare",
+	16509:  {"Amazon.com / AWS", UsageCloud},
+	14618:  {"Amazon.com / AWS", UsageCloud},
+	8075:   {"Microsoft Azure", UsageCloud},
+	15169:  {"Google Cloud", UsageCloud},
+	396982: {"Google Cloud", UsageCloud},
+	45102:  {"Alibaba Cloud", UsageCloud},
+	45090:  {"Tencent Cloud", UsageCloud},
+	132203: {"Tencent Cloud", UsageCloud},
+	31898:  {"Oracle Cloud", UsageCloud},
+	36351:  {"IBM Cloud / SoftLayer", UsageCloud},
+	13335:  {"Cloudflare", UsageCDN},
 
 	// === VPS / Hosting Providers ===
-	14061:  "DigitalOcean",
-	20473:  "Vultr / Choopa",
-	63949:  "Linode / Akamai Connected Cloud",
-	396998: "Linode / Akamai Connected Cloud",
-	16276:  "OVHcloud",
-	24940:  "Hetzner Online",
-	12876:  "Scaleway (Online SAS)",
-	40021:  "Contabo",
-	51167:  "Contabo",
-	209605: "Contabo Asia",
-	60781:  "LeaseWeb",
-	28753:  "LeaseWeb",
-	30633:  "LeaseWeb",
-	9009:   "M247 / G-Core Labs",
-	199524: "G-Core Labs",
-	202053: "UpCloud",
-	35540:  "MivoCloud",
-	42730:  "EVOCATIVE (eStruxture)",
-	55286:  "Equinix Metal (Packet)",
-	13414:  "Twitter / X Infrastructure",
+	14061:  {"DigitalOcean", UsageHosting},
+	20473:  {"Vultr / Choopa", UsageHosting},
+	63949:  {"Linode / Akamai Connected Cloud", UsageHosting},
+	396998: {"Linode / Akamai Connected Cloud", UsageHosting},
+	16276:  {"OVHcloud", UsageHosting},
+	24940:  {"Hetzner Online", UsageHosting},
+	12876:  {"Scaleway (Online SAS)", UsageHosting},
+	40021:  {"Contabo", UsageHosting},
+	51167:  {"Contabo", UsageHosting},
+	209605: {"Contabo Asia", UsageHosting},
+	60781:  {"LeaseWeb", UsageHosting},
+	28753:  {"LeaseWeb", UsageHosting},
+	30633:  {"LeaseWeb", UsageHosting},
+	9009:   {"M247 / G-Core Labs", UsageHosting},
+	199524: {"G-Core Labs", UsageHosting},
+	202053: {"UpCloud", UsageHosting},
+	35540:  {"MivoCloud", UsageHosting},
+	42730:  {"EVOCATIVE (eStruxture)", UsageHosting},
+	55286:  {"Equinix Metal (Packet)", UsageHosting},
+	13414:  {"Twitter / X Infrastructure", UsageHosting},
 
 	// === Dedicated Server / Colocation ===
-	33070:  "Rackspace",
-	19994:  "Rackspace",
-	36352:  "ColoCrossing",
-	40676:  "Psychz Networks",
-	8100:   "QuadraNet",
-	23352:  "ServerCentral",
-	21859:  "Zenlayer",
-	54574:  "DMIT",
-	906:    "DMIT",
-	25820:  "IT7 Networks (BandwagonHost)",
-	36007:  "Kamatera",
-	54290:  "Hostwinds",
-	62567:  "DigitalOcean (NYC)",
-	46664:  "VolumeDrive",
-	30083:  "HEG US (Hetzner US)",
-	62563:  "GTHost",
-	398101: "GoDaddy Cloud",
-	26496:  "GoDaddy Hosting",
-	394695: "Google Cloud (Dedicated)",
-	19527:  "Google Fiber (Cloud)",
+	33070:  {"Rackspace", UsageHosting},
+	19994:  {"Rackspace", UsageHosting},
+	36352:  {"ColoCrossing", UsageHosting},
+	40676:  {"Psychz Networks", UsageHosting},
+	8100:   {"QuadraNet", UsageHosting},
+	23352:  {"ServerCentral", UsageHosting},
+	21859:  {"Zenlayer", UsageHosting},
+	54574:  {"DMIT", UsageHosting},
+	906:    {"DMIT", UsageHosting},
+	25820:  {"IT7 Networks (BandwagonHost)", UsageHosting},
+	36007:  {"Kamatera", UsageHosting},
+	54290:  {"Hostwinds", UsageHosting},
+	62567:  {"DigitalOcean (NYC)", UsageHosting},
+	46664:  {"VolumeDrive", UsageHosting},
+	30083:  {"HEG US (Hetzner US)", UsageHosting},
+	62563:  {"GTHost", UsageHosting},
+	398101: {"GoDaddy Cloud", UsageHosting},
+	26496:  {"GoDaddy Hosting", UsageHosting},
+	394695: {"Google Cloud (Dedicated)", UsageHosting},
+	19527:  {"Google Fiber (Cloud)", UsageHosting},
 
 	// === Asian Hosting Providers ===
-	38001:  "NewMedia Express (SG)",
-	45753:  "NTT SmartConnect (JP)",
-	142594: "SpeedyPage Ltd",
-	132335: "LeapSwitch (IN)",
-	55720:  "Gigabit Hosting (MY)",
-	38731:  "Vietel IDC (VN)",
-	45899:  "VNPT (VN IDC)",
-	37963:  "Alibaba Cloud (HK)",
-	131477: "Sify Technologies (IN)",
-	55933:  "Cloudie (HK)",
-	141995: "Tencent Cloud AP",
+	38001:  {"NewMedia Express (SG)", UsageHosting},
+	45753:  {"NTT SmartConnect (JP)", UsageHosting},
+	142594: {"SpeedyPage Ltd", UsageHosting},
+	132335: {"LeapSwitch (IN)", UsageHosting},
+	55720:  {"Gigabit Hosting (MY)", UsageHosting},
+	38731:  {"Vietel IDC (VN)", UsageHosting},
+	45899:  {"VNPT (VN IDC)", UsageHosting},
+	37963:  {"Alibaba Cloud (HK)", UsageHosting},
+	131477: {"Sify Technologies (IN)", UsageHosting},
+	55933:  {"Cloudie (HK)", UsageHosting},
+	141995: {"Tencent Cloud AP", UsageHosting},
 
 	// === European Hosting ===
-	47583:  "Hostinger",
-	44477:  "Stark Industries (Hosting)",
-	197540: "Netcup",
-	34549:  "Meer Web (NL)",
-	29066:  "velia.net",
-	50673:  "Serverius",
-	60068:  "Datacamp (CDN77)",
-	212238: "Datacamp (CDN77)",
-	42831:  "UK Dedicated Servers",
-	213230: "Hetzner Cloud",
-	200019: "AlexHost (MD)",
-	59711:  "HZ Hosting",
+	47583:  {"Hostinger", UsageHosting},
+	44477:  {"Stark Industries (Hosting)", UsageHosting},
+	197540: {"Netcup", UsageHosting},
+	34549:  {"Meer Web (NL)", UsageHosting},
+	29066:  {"velia.net", UsageHosting},
+	50673:  {"Serverius", UsageHosting},
+	60068:  {"Datacamp (CDN77)", UsageHosting},
+	212238: {"Datacamp (CDN77)", UsageHosting},
+	42831:  {"UK Dedicated Servers", UsageHosting},
+	213230: {"Hetzner Cloud", UsageHosting},
+	200019: {"AlexHost (MD)", UsageHosting},
+	59711:  {"HZ Hosting", UsageHosting},
 
 	// === Russian / CIS Hosting ===
-	49981:  "WorldStream",
-	48282:  "HIVELOCITY",
-	35415:  "Webzilla",
-	50979:  "Selectel",
-	208091: "Postman (Hosting)",
+	49981:  {"WorldStream", UsageHosting},
+	48282:  {"HIVELOCITY", UsageHosting},
+	35415:  {"Webzilla", UsageHosting},
+	50979:  {"Selectel", UsageHosting},
+	208091: {"Postman (Hosting)", UsageHosting},
 
 	// === VPN / Proxy Infrastructure ===
-	206092: "VPN providers infrastructure",
-	396356: "Maxihost",
+	206092: {"VPN providers infrastructure", UsageVPN},
+	396356: {"Maxihost", UsageHosting},
 
 	// === CDN / Edge ===
-	20940:  "Akamai Technologies",
-	54113:  "Fastly",
-	209242: "Cloudflare (WARP)",
-	132892: "Cloudflare (AP)",
-	397213: "Cloudflare",
-}
+	20940:  {"Akamai Technologies", UsageCDN},
+	54113:  {"Fastly", UsageCDN},
+	209242: {"Cloudflare (WARP)", UsageCDN},
+	132892: {"Cloudflare (AP)", UsageCDN},
+	397213: {"Cloudflare", UsageCDN},
 
-// ResidentialASNs contains known large ISP ASNs that should never be classified as datacenter.
-// These ISPs serve massive residential/mobile user bases; even if their org name contains "Cloud",
-// the vast majority of IPs are regular end-users (e.g. 4G/5G mobile).
-var ResidentialASNs = map[int]string{
 	// === Chinese Major ISPs ===
-	9808:  "China Mobile",
-	56040: "China Mobile", // Often labeled "China Mobile Cloud" but carries 4G/5G users
-	56041: "China Mobile International",
-	56042: "China Mobile",
-	56046: "China Mobile",
-	56048: "China Mobile",
-	24400: "China Mobile",
-	24444: "China Mobile",
-	4134:  "China Telecom (ChinaNet)",
-	4812:  "China Telecom (Next Carrier Network)",
-	58461: "China Telecom", // Often labeled "China Telecom Cloud" but carries residential users
-	23724: "China Telecom",
-	4837:  "China Unicom (CNCNET)",
-	4808:  "China Unicom",
-	17621: "China Unicom",
-	17816: "China Unicom",
-	9394:  "China Unicom",
+	9808:  {"China Mobile", UsageMobile},
+	56040: {"China Mobile", UsageMobile}, // Often labeled "China Mobile Cloud" but carries 4G/5G users
+	56041: {"China Mobile International", UsageMobile},
+	56042: {"China Mobile", UsageMobile},
+	56046: {"China Mobile", UsageMobile},
+	56048: {"China Mobile", UsageMobile},
+	24400: {"China Mobile", UsageMobile},
+	24444: {"China Mobile", UsageMobile},
+	4134:  {"China Telecom (ChinaNet)", UsageISP},
+	4812:  {"China Telecom (Next Carrier Network)", UsageISP},
+	58461: {"China Telecom", UsageISP}, // Often labeled "China Telecom Cloud" but carries residential users
+	23724: {"China Telecom", UsageISP},
+	4837:  {"China Unicom (CNCNET)", UsageISP},
+	4808:  {"China Unicom", UsageISP},
+	17621: {"China Unicom", UsageISP},
+	17816: {"China Unicom", UsageISP},
+	9394:  {"China Unicom", UsageISP},
+
+	// === Education / Research ===
+	11537: {"Internet2", UsageEducation},
+	4538:  {"CERNET (China Education and Research Network)", UsageEducation},
+	786:   {"Jisc (JANET)", UsageEducation},
+
+	// === Government ===
+	721: {"DoD Network Information Center", UsageGovernment},
+}
+
+// LookupASN returns the classification of an ASN.
+func LookupASN(asn int) (ASNEntry, bool) {
+	e, ok := currentASNLists().entries[asn]
+	return e, ok
 }
 
 // IsKnownDatacenterASN checks if an ASN belongs to a known datacenter.
 func IsKnownDatacenterASN(asn int) (string, bool) {
-	org, ok := DatacenterASNs[asn]
-	return org, ok
+	if e, ok := LookupASN(asn); ok && e.Usage.IsDatacenter() {
+		return e.Org, true
+	}
+	return "", false
 }
 
 // IsKnownResidentialASN checks if an ASN belongs to a known residential ISP.
 func IsKnownResidentialASN(asn int) (string, bool) {
-	org, ok := ResidentialASNs[asn]
-	return org, ok
+	if e, ok := LookupASN(asn); ok && e.Usage.IsResidential() {
+		return e.Org, true
+	}
+	return "", false
 }
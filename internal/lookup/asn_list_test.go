@@ -1,6 +1,10 @@
 package lookup
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
 
 func TestKnownDatacenterASNsIncludeObservedHostingProviders(t *testing.T) {
 	cases := map[int]string{
@@ -37,3 +41,26 @@ func TestKnownResidentialASNsKeepChineseCarriersResidential(t *testing.T) {
 		}
 	}
 }
+
+func TestKnownASNsUsageTypes(t *testing.T) {
+	cases := map[int]UsageType{
+		16509: UsageCloud,
+		14061: UsageHosting,
+		20940: UsageCDN,
+		9808:  UsageMobile,
+		4134:  UsageISP,
+		11537: UsageEducation,
+	}
+	for asn, want := range cases {
+		e, ok := LookupASN(asn)
+		if !ok || e.Usage != want {
+			t.Errorf("ASN %d usage = %q, %v, want %q", asn, e.Usage, ok, want)
+		}
+	}
+
+	info := &model.IPInfo{ASN: 20940}
+	markDatacenterASN(info)
+	if info.UsageType != "cdn" || info.Provenance["usage_type"] != SourceASNList {
+		t.Errorf("usage_type = %q (provenance %q), want cdn from asn-list", info.UsageType, info.Provenance["usage_type"])
+	}
+}
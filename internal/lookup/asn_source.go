@@ -0,0 +1,370 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// asnLists is an immutable snapshot of the classified ASNs. Lookups read
+// the active snapshot without locking; a reload builds a new one and swaps
+// it in.
+type asnLists struct {
+	entries map[int]ASNEntry
+}
+
+// count returns the number of datacenter and residential entries.
+func (l *asnLists) count() (datacenter, residential int) {
+	for _, e := range l.entries {
+		switch {
+		case e.Usage.IsDatacenter():
+			datacenter++
+		case e.Usage.IsResidential():
+			residential++
+		}
+	}
+	return datacenter, residential
+}
+
+var activeASNLists atomic.Pointer[asnLists]
+
+func init() {
+	activeASNLists.Store(builtinASNLists())
+}
+
+// currentASNLists returns the active ASN lists.
+func currentASNLists() *asnLists {
+	return activeASNLists.Load()
+}
+
+// knownDatacenterASNs returns the number of active datacenter ASNs.
+func knownDatacenterASNs() int {
+	n, _ := currentASNLists().count()
+	return n
+}
+
+// builtinASNLists returns a copy of the compiled-in list.
+func builtinASNLists() *asnLists {
+	l := &asnLists{entries: make(map[int]ASNEntry, len(KnownASNs))}
+	for asn, e := range KnownASNs {
+		l.entries[asn] = e
+	}
+	return l
+}
+
+// asnListFile is the YAML/JSON format of an ASN list file.
+//
+//	asns:
+//	  - asn: 11537
+//	    org: Internet2
+//	    usage: education
+//	datacenter:
+//	  - asn: 212238
+//	    org: Datacamp Limited
+//	    usage: cdn
+//	residential:
+//	  - asn: 3320
+//	    org: Deutsche Telekom
+//	remove: [13335]
+//
+// "asns" entries need a usage type. "datacenter" and "residential" are
+// shorthands whose usage defaults to hosting and isp and must be of the
+// matching kind.
+//
+// The CSV format has one "category,asn,org" row per entry, where category
+// is a usage type, datacenter, residential or remove (org is optional for
+// remove). A header row and lines starting with "#" are ignored.
+type asnListFile struct {
+	ASNs        []asnListEntry `json:"asns" yaml:"asns"`
+	Datacenter  []asnListEntry `json:"datacenter" yaml:"datacenter"`
+	Residential []asnListEntry `json:"residential" yaml:"residential"`
+	Remove      []int          `json:"remove" yaml:"remove"` // drop entries, e.g. a wrong built-in one
+}
+
+type asnListEntry struct {
+	ASN   int       `json:"asn" yaml:"asn"`
+	Org   string    `json:"org" yaml:"org"`
+	Usage UsageType `json:"usage" yaml:"usage"`
+}
+
+const maxASN = 1<<32 - 1
+
+// parseASNListFile reads an ASN list file, choosing the format by extension.
+func parseASNListFile(path string) (*asnListFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f asnListFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".csv":
+		if err := parseASNListCSV(data, &f); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported ASN list format, want .yaml, .json or .csv", path)
+	}
+
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &f, nil
+}
+
+func parseASNListCSV(data []byte, f *asnListFile) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	for first := true; ; first = false {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := r.FieldPos(0)
+		if first && strings.EqualFold(rec[0], "category") {
+			continue
+		}
+		if len(rec) < 2 {
+			return fmt.Errorf("line %d: want category,asn,org", line)
+		}
+
+		asn, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rec[1])), "AS"))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid ASN %q", line, rec[1])
+		}
+		var org string
+		if len(rec) > 2 {
+			org = strings.TrimSpace(rec[2])
+		}
+
+		switch category := strings.ToLower(strings.TrimSpace(rec[0])); category {
+		case "datacenter":
+			f.Datacenter = append(f.Datacenter, asnListEntry{ASN: asn, Org: org})
+		case "residential":
+			f.Residential = append(f.Residential, asnListEntry{ASN: asn, Org: org})
+		case "remove":
+			f.Remove = append(f.Remove, asn)
+		default:
+			if !UsageType(category).Valid() {
+				return fmt.Errorf("line %d: unknown category %q", line, rec[0])
+			}
+			f.ASNs = append(f.ASNs, asnListEntry{ASN: asn, Org: org, Usage: UsageType(category)})
+		}
+	}
+}
+
+// validate checks ASN ranges, required org names and usage types, and that
+// no ASN appears more than once. It fills in the default usage types of the
+// datacenter and residential shorthands.
+func (f *asnListFile) validate() error {
+	seen := make(map[int]string)
+	check := func(category string, i, asn int) error {
+		if asn <= 0 || asn > maxASN {
+			return fmt.Errorf("%s[%d]: invalid ASN %d", category, i, asn)
+		}
+		if prev, ok := seen[asn]; ok {
+			return fmt.Errorf("%s[%d]: ASN %d is also listed under %s", category, i, asn, prev)
+		}
+		seen[asn] = category
+		return nil
+	}
+
+	for _, list := range []struct {
+		category string
+		entries  []asnListEntry
+		def      UsageType
+		fits     func(UsageType) bool
+	}{
+		{"asns", f.ASNs, "", UsageType.Valid},
+		{"datacenter", f.Datacenter, UsageHosting, UsageType.IsDatacenter},
+		{"residential", f.Residential, UsageISP, UsageType.IsResidential},
+	} {
+		for i := range list.entries {
+			e := &list.entries[i]
+			if err := check(list.category, i, e.ASN); err != nil {
+				return err
+			}
+			if strings.TrimSpace(e.Org) == "" {
+				return fmt.Errorf("%s[%d]: ASN %d has no org", list.category, i, e.ASN)
+			}
+			if e.Usage == "" {
+				e.Usage = list.def
+			}
+			if !list.fits(e.Usage) {
+				return fmt.Errorf("%s[%d]: ASN %d has invalid usage %q", list.category, i, e.ASN, e.Usage)
+			}
+		}
+	}
+	for i, asn := range f.Remove {
+		if err := check("remove", i, asn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTo merges the file into l. Entries replace earlier classifications of
+// the same ASN, so a later file can reclassify a built-in ASN.
+func (f *asnListFile) applyTo(l *asnLists) {
+	for _, asn := range f.Remove {
+		delete(l.entries, asn)
+	}
+	for _, list := range [][]asnListEntry{f.ASNs, f.Datacenter, f.Residential} {
+		for _, e := range list {
+			l.entries[e.ASN] = ASNEntry{Org: strings.TrimSpace(e.Org), Usage: e.Usage}
+		}
+	}
+}
+
+// loadASNLists builds the lists from the built-in defaults plus the given
+// files, applied in order.
+func loadASNLists(paths []string) (*asnLists, error) {
+	l := builtinASNLists()
+	for _, path := range paths {
+		f, err := parseASNListFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f.applyTo(l)
+	}
+	return l, nil
+}
+
+// fileStamp identifies a version of a file for change detection.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+}
+
+// equal reports whether s and o describe the same version of a file. Times
+// are compared with Equal, != would also compare their locations.
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.modTime.Equal(o.modTime) && s.size == o.size
+}
+
+// asnListLoader loads ASN_LIST_FILES and reloads them when they change.
+type asnListLoader struct {
+	paths []string
+
+	mu     sync.Mutex
+	stamps []fileStamp // stamps of the files as last seen, parallel to paths
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// newASNListLoader loads the files on top of the built-in lists. If a file is
+// missing or invalid the built-in lists stay active until a reload succeeds.
+// With reloadInterval > 0 the files are checked periodically.
+func newASNListLoader(paths []string, reloadInterval time.Duration) *asnListLoader {
+	l := &asnListLoader{
+		paths:  paths,
+		stamps: make([]fileStamp, len(paths)),
+		stopCh: make(chan struct{}),
+	}
+	if err := l.Reload(); err != nil {
+		log.Printf("[asn-list] %v, using built-in lists", err)
+	}
+	if reloadInterval > 0 {
+		go l.watch(reloadInterval)
+	}
+	return l
+}
+
+// Reload reads all files again and swaps in the merged lists. On error the
+// current lists stay active.
+func (l *asnListLoader) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, path := range l.paths {
+		l.stamps[i] = statFile(path)
+	}
+	lists, err := loadASNLists(l.paths)
+	if err != nil {
+		return err
+	}
+	activeASNLists.Store(lists)
+	datacenter, residential := lists.count()
+	log.Printf("[asn-list] Loaded %d ASNs (%d datacenter, %d residential) from %s",
+		len(lists.entries), datacenter, residential, strings.Join(l.paths, ", "))
+	return nil
+}
+
+// changed reports whether any file differs from when it was last loaded.
+func (l *asnListLoader) changed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, path := range l.paths {
+		if !statFile(path).equal(l.stamps[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *asnListLoader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !l.changed() {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				log.Printf("[asn-list] Reload failed, keeping current lists: %v", err)
+			}
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// Close stops the file watcher.
+func (l *asnListLoader) Close() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stopCh) })
+}
@@ -0,0 +1,158 @@
+package lookup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// restoreASNLists puts the lists active before the test back afterwards.
+func restoreASNLists(t *testing.T) {
+	prev := currentASNLists()
+	t.Cleanup(func() { activeASNLists.Store(prev) })
+}
+
+func TestASNListFilesMergeOverBuiltins(t *testing.T) {
+	restoreASNLists(t)
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "hosting.yaml")
+	writeFile(t, yamlPath, `
+datacenter:
+  - asn: 64496
+    org: Example Hosting
+residential:
+  - asn: 16509
+    org: Not really AWS
+remove: [13335]
+`)
+	jsonPath := filepath.Join(dir, "extra.json")
+	writeFile(t, jsonPath, `{"datacenter": [{"asn": 64497, "org": "JSON Hosting"}]}`)
+	csvPath := filepath.Join(dir, "ops.csv")
+	writeFile(t, csvPath, "category,asn,org\n# moved back by ops\ndatacenter,AS16509,Amazon.com / AWS\nresidential,64498,Example Broadband\n")
+
+	l := newASNListLoader([]string{yamlPath, jsonPath, csvPath}, 0)
+	defer l.Close()
+
+	for asn, want := range map[int]string{64496: "Example Hosting", 64497: "JSON Hosting", 16509: "Amazon.com / AWS"} {
+		if org, ok := IsKnownDatacenterASN(asn); !ok || org != want {
+			t.Errorf("IsKnownDatacenterASN(%d) = %q, %v, want %q", asn, org, ok, want)
+		}
+	}
+	if _, ok := IsKnownResidentialASN(16509); ok {
+		t.Error("later file should move ASN 16509 back to datacenter")
+	}
+	if _, ok := IsKnownDatacenterASN(13335); ok {
+		t.Error("removed built-in ASN 13335 should not be datacenter")
+	}
+	if org, ok := IsKnownResidentialASN(64498); !ok || org != "Example Broadband" {
+		t.Errorf("IsKnownResidentialASN(64498) = %q, %v", org, ok)
+	}
+	// Untouched built-ins stay
+	if _, ok := IsKnownResidentialASN(4134); !ok {
+		t.Error("built-in residential ASN 4134 should remain")
+	}
+}
+
+func TestASNListFileValidation(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]struct {
+		name, content, wantErr string
+	}{
+		"zero asn":       {"a.yaml", "datacenter:\n  - asn: 0\n    org: X\n", "invalid ASN 0"},
+		"missing org":    {"b.json", `{"datacenter": [{"asn": 64496}]}`, "has no org"},
+		"conflict":       {"c.csv", "datacenter,64496,A\nresidential,64496,B\n", "also listed under datacenter"},
+		"unknown field":  {"d.json", `{"hosting": []}`, "unknown field"},
+		"unknown column": {"e.csv", "tor,64496,A\n", "unknown category"},
+		"bad usage":      {"g.yaml", "asns:\n  - asn: 64496\n    org: X\n    usage: bakery\n", "invalid usage"},
+		"wrong kind":     {"h.json", `{"datacenter": [{"asn": 64496, "org": "X", "usage": "mobile"}]}`, "invalid usage"},
+		"bad extension":  {"f.txt", "", "unsupported"},
+	}
+	for name, tc := range cases {
+		path := filepath.Join(dir, tc.name)
+		writeFile(t, path, tc.content)
+		_, err := parseASNListFile(path)
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want containing %q", name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestASNListHotReloadKeepsListsOnInvalidFile(t *testing.T) {
+	restoreASNLists(t)
+	path := filepath.Join(t.TempDir(), "hosting.csv")
+	writeFile(t, path, "datacenter,64496,First\n")
+
+	l := newASNListLoader([]string{path}, 10*time.Millisecond)
+	defer l.Close()
+	if _, ok := IsKnownDatacenterASN(64496); !ok {
+		t.Fatal("initial file not loaded")
+	}
+
+	replace := func(content string) {
+		tmp := path + ".tmp"
+		writeFile(t, tmp, content)
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(cond func() bool, what string) {
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	replace("datacenter,64496,First\ndatacenter,64497,Second\n")
+	waitFor(func() bool { _, ok := IsKnownDatacenterASN(64497); return ok }, "reload")
+
+	replace("datacenter,not-a-number,Broken\n")
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := IsKnownDatacenterASN(64497); !ok {
+		t.Error("invalid file should keep the previous lists")
+	}
+}
+
+func TestASNListFileUsageTypes(t *testing.T) {
+	restoreASNLists(t)
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "usage.yaml")
+	writeFile(t, yamlPath, `
+asns:
+  - asn: 64496
+    org: Example University
+    usage: education
+datacenter:
+  - asn: 64497
+    org: Example CDN
+    usage: cdn
+  - asn: 64498
+    org: Example VPS
+`)
+	csvPath := filepath.Join(dir, "usage.csv")
+	writeFile(t, csvPath, "mobile,64499,Example Mobile\n")
+
+	l := newASNListLoader([]string{yamlPath, csvPath}, 0)
+	defer l.Close()
+
+	want := map[int]UsageType{64496: UsageEducation, 64497: UsageCDN, 64498: UsageHosting, 64499: UsageMobile}
+	for asn, usage := range want {
+		if e, ok := LookupASN(asn); !ok || e.Usage != usage {
+			t.Errorf("LookupASN(%d) = %+v, %v, want usage %q", asn, e, ok, usage)
+		}
+	}
+	if _, ok := IsKnownDatacenterASN(64496); ok {
+		t.Error("education ASN should not be datacenter")
+	}
+	if _, ok := IsKnownResidentialASN(64496); ok {
+		t.Error("education ASN should not be residential")
+	}
+	if _, ok := IsKnownResidentialASN(64499); !ok {
+		t.Error("mobile ASN should be residential")
+	}
+}
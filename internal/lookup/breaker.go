@@ -0,0 +1,186 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// callOutcome classifies a provider call for the circuit breaker.
+type callOutcome int
+
+const (
+	outcomeSuccess callOutcome = iota // the provider answered
+	outcomeFailure                    // HTTP 429/5xx, network error or timeout
+	outcomeIgnored                    // the caller canceled or ran out of time, says nothing about the provider
+)
+
+// classifyCallError maps a provider error to a breaker outcome.
+// Any HTTP answer other than 429/5xx counts as success: the provider is up,
+// it just could not answer for this IP. A timeout counts as failure only if
+// it was the provider's own: once ctx is done (the caller canceled, or the
+// overall lookup deadline passed, perhaps used up by slower providers) the
+// call is ignored.
+func classifyCallError(ctx context.Context, err error) callOutcome {
+	if err == nil {
+		return outcomeSuccess
+	}
+	if ctx.Err() != nil {
+		return outcomeIgnored
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.Code == 429 || statusErr.Code >= 500 {
+			return outcomeFailure
+		}
+		return outcomeSuccess
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+// circuitBreaker stops sending requests to a failing provider.
+//
+// After threshold consecutive failures it opens for a cooldown. Once the
+// cooldown expires it lets a single probe call through (half-open): success
+// closes it, failure reopens it with the cooldown doubled, up to maxCooldown.
+// A zero threshold disables the breaker.
+type circuitBreaker struct {
+	threshold    int
+	baseCooldown time.Duration
+	maxCooldown  time.Duration
+
+	mu        sync.Mutex
+	state     breakerState
+	failures  int // consecutive failures
+	trips     int // consecutive openings without a successful probe, drives backoff
+	openUntil time.Time
+	probing   bool // a half-open probe is in flight
+}
+
+// ready reports whether a call would be allowed, without reserving it.
+func (b *circuitBreaker) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		return !time.Now().Before(b.openUntil)
+	case breakerHalfOpen:
+		return !b.probing
+	default:
+		return true
+	}
+}
+
+// allow reports whether a call may be made. In half-open state it reserves
+// the single probe slot, which is released by the next record call.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of an allowed call and
+// returns the new state and whether it changed. Failures of calls still in
+// flight when the breaker opened are ignored, so one incident counts as a
+// single trip.
+func (b *circuitBreaker) record(outcome callOutcome) (breakerState, bool) {
+	if b.threshold <= 0 {
+		return breakerClosed, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prev := b.state
+	switch outcome {
+	case outcomeSuccess:
+		b.state = breakerClosed
+		b.failures = 0
+		b.trips = 0
+		b.probing = false
+	case outcomeFailure:
+		switch b.state {
+		case breakerOpen:
+			// already counted
+		case breakerHalfOpen:
+			b.failures++
+			b.open() // failed probe
+		default:
+			b.failures++
+			if b.failures >= b.threshold {
+				b.open()
+			}
+		}
+	case outcomeIgnored:
+		b.probing = false
+	}
+	return b.state, b.state != prev
+}
+
+// open moves the breaker to open with an exponentially growing cooldown.
+// Caller must hold b.mu.
+func (b *circuitBreaker) open() {
+	cooldown := b.baseCooldown
+	for i := 0; i < b.trips && (b.maxCooldown <= 0 || cooldown < b.maxCooldown); i++ {
+		cooldown *= 2
+	}
+	if b.maxCooldown > 0 && cooldown > b.maxCooldown {
+		cooldown = b.maxCooldown
+	}
+	b.trips++
+	b.state = breakerOpen
+	b.probing = false
+	b.openUntil = time.Now().Add(cooldown)
+}
+
+// snapshot returns the breaker state for stats.
+func (b *circuitBreaker) snapshot() (state breakerState, failures int, openUntil time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.failures, b.openUntil
+}
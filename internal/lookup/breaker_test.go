@@ -0,0 +1,107 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	b := &circuitBreaker{threshold: 3, baseCooldown: time.Minute, maxCooldown: 4 * time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("call %d should be allowed while closed", i)
+		}
+		b.record(outcomeFailure)
+	}
+	if b.allow() {
+		t.Fatal("breaker should be open after 3 failures")
+	}
+
+	// Cooldown elapsed: exactly one probe goes through.
+	b.openUntil = time.Now().Add(-time.Second)
+	if !b.allow() {
+		t.Fatal("probe should be allowed after cooldown")
+	}
+	if b.allow() {
+		t.Fatal("only one probe may be in flight")
+	}
+
+	// Failed probe reopens with doubled cooldown.
+	start := time.Now()
+	if state, _ := b.record(outcomeFailure); state != breakerOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+	if got := b.openUntil.Sub(start); got < 2*time.Minute-time.Second || got > 2*time.Minute+time.Second {
+		t.Fatalf("second cooldown = %s, want ~2m", got)
+	}
+
+	// Successful probe closes it.
+	b.openUntil = time.Now().Add(-time.Second)
+	b.allow()
+	if state, changed := b.record(outcomeSuccess); state != breakerClosed || !changed {
+		t.Fatalf("state = %s changed=%v, want closed", state, changed)
+	}
+	if !b.allow() {
+		t.Fatal("closed breaker should allow calls")
+	}
+}
+
+func TestCircuitBreakerIgnoresFailuresWhileOpen(t *testing.T) {
+	b := &circuitBreaker{threshold: 3, baseCooldown: time.Minute, maxCooldown: 8 * time.Minute}
+
+	// A burst of in-flight calls failing together
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		b.record(outcomeFailure)
+	}
+	if got := b.openUntil.Sub(start); got < time.Minute-time.Second || got > time.Minute+time.Second {
+		t.Fatalf("cooldown = %s, want ~1m", got)
+	}
+	if b.trips != 1 || b.failures != 3 {
+		t.Fatalf("trips = %d, failures = %d, want 1, 3", b.trips, b.failures)
+	}
+}
+
+func TestCircuitBreakerReleasesProbeOnIgnoredOutcome(t *testing.T) {
+	b := &circuitBreaker{threshold: 1, baseCooldown: time.Minute, maxCooldown: time.Minute}
+	b.record(outcomeFailure)
+	b.openUntil = time.Now().Add(-time.Second)
+
+	b.allow()
+	b.record(outcomeIgnored)
+	if !b.allow() {
+		t.Fatal("a canceled probe should free the probe slot")
+	}
+}
+
+func TestClassifyCallError(t *testing.T) {
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want callOutcome
+	}{
+		{"ok", ctx, nil, outcomeSuccess},
+		{"rate limited", ctx, &httpStatusError{Code: 429}, outcomeFailure},
+		{"server error", ctx, &httpStatusError{Code: 503}, outcomeFailure},
+		{"not found", ctx, &httpStatusError{Code: 404}, outcomeSuccess},
+		{"timeout", ctx, context.DeadlineExceeded, outcomeFailure},
+		{"api error", ctx, errors.New("ip-api error: reserved range"), outcomeSuccess},
+		{"caller canceled", canceled, context.Canceled, outcomeIgnored},
+		{"lookup deadline", expired, context.DeadlineExceeded, outcomeIgnored},
+	}
+	for _, c := range cases {
+		if got := classifyCallError(c.ctx, c.err); got != c.want {
+			t.Errorf("%s: outcome = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/iptrie"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// SourceCloudRanges is the provenance of values set from published cloud ranges.
+const SourceCloudRanges = "cloud-ranges"
+
+// cloudRange is the classification of one published prefix.
+type cloudRange struct {
+	Label string // e.g. "AWS EC2 us-east-1"
+	// Generic ranges are aggregates such as AWS "AMAZON" or Azure "AzureCloud"
+	// that repeat the prefixes of specific services. A specific entry for the
+	// same prefix wins.
+	Generic bool
+}
+
+// cloudRanges is an immutable index of published cloud prefixes, matched by
+// longest prefix. Lookups read the active index without locking; a reload
+// builds a new one and swaps it in.
+type cloudRanges struct {
+	trie *iptrie.Trie[cloudRange]
+}
+
+func newCloudRanges() *cloudRanges {
+	return &cloudRanges{trie: iptrie.New[cloudRange]()}
+}
+
+// len returns the number of indexed prefixes.
+func (c *cloudRanges) len() int {
+	return c.trie.Len()
+}
+
+// add indexes r under p. An existing entry for p is replaced only by a
+// specific entry replacing a generic one.
+func (c *cloudRanges) add(p netip.Prefix, r cloudRange) {
+	if prev, ok := c.trie.Get(p); ok && (!prev.Generic || r.Generic) {
+		return
+	}
+	c.trie.Insert(p, r)
+}
+
+// match returns the range with the longest prefix containing addr.
+func (c *cloudRanges) match(addr netip.Addr) (cloudRange, bool) {
+	_, r, ok := c.trie.Lookup(addr)
+	return r, ok
+}
+
+// markCloudRange flags info as a datacenter IP from a published cloud range.
+// The usage type becomes cloud unless the ASN list already classifies the
+// ASN as a datacenter kind, e.g. cdn for Cloudflare.
+func markCloudRange(info *model.IPInfo, r cloudRange) {
+	info.IsDatacenter = true
+	info.CloudService = r.Label
+	setProvenance(info, SourceCloudRanges, "is_datacenter", "cloud_service")
+	setConfidence(info, "is_datacenter", confidenceASNList)
+	if !UsageType(info.UsageType).IsDatacenter() {
+		info.UsageType = string(UsageCloud)
+		setProvenance(info, SourceCloudRanges, "usage_type")
+	}
+}
+
+// cloudRangeSource is one CLOUD_RANGE_FILES entry, "path" or "name=path".
+type cloudRangeSource struct {
+	name string // vendor name for CSV and plain-text lists
+	path string
+}
+
+func parseCloudRangeSource(s string) cloudRangeSource {
+	if name, path, ok := strings.Cut(s, "="); ok {
+		return cloudRangeSource{name: strings.TrimSpace(name), path: strings.TrimSpace(path)}
+	}
+	return cloudRangeSource{path: s}
+}
+
+// cloudRangeDoc covers the JSON formats:
+//
+//   - AWS ip-ranges.json: prefixes[].ip_prefix, ipv6_prefixes[].ipv6_prefix, with region and service
+//   - GCP cloud.json: prefixes[].ipv4Prefix / ipv6Prefix, with service and scope
+//   - Azure Service Tags: values[].properties.addressPrefixes, with region and systemService
+//   - Oracle public_ip_ranges.json: regions[].cidrs[].cidr, with tags
+type cloudRangeDoc struct {
+	Prefixes []struct {
+		IPPrefix   string `json:"ip_prefix"`
+		IPv4Prefix string `json:"ipv4Prefix"`
+		IPv6Prefix string `json:"ipv6Prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+		Scope      string `json:"scope"`
+	} `json:"prefixes"`
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+	Values []struct {
+		Name       string `json:"name"`
+		Properties struct {
+			Region          string   `json:"region"`
+			SystemService   string   `json:"systemService"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+	Regions []struct {
+		Region string `json:"region"`
+		CIDRs  []struct {
+			CIDR string   `json:"cidr"`
+			Tags []string `json:"tags"`
+		} `json:"cidrs"`
+	} `json:"regions"`
+}
+
+// label joins the non-empty parts with spaces.
+func label(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// parseCloudRangeFile reads a published range file into c. The format is
+// detected from the content: one of the JSON formats of cloudRangeDoc, the
+// DigitalOcean CSV ("prefix,country,region,city,postal"), or a plain list
+// with one CIDR per line such as Cloudflare's ips-v4 / ips-v6. The plain list
+// needs a name, which becomes the label.
+func parseCloudRangeFile(src cloudRangeSource, c *cloudRanges) error {
+	data, err := os.ReadFile(src.path)
+	if err != nil {
+		return err
+	}
+	before := c.len()
+	add := func(cidr string, r cloudRange) error {
+		p, err := parsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return err
+		}
+		c.add(p, r)
+		return nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		err = parseCloudRangeJSON(trimmed, add)
+	case isCSV(trimmed):
+		name := src.name
+		if name == "" {
+			name = "DigitalOcean"
+		}
+		err = parseCloudRangeCSV(trimmed, name, add)
+	default:
+		if src.name == "" {
+			return fmt.Errorf("%s: a plain CIDR list needs a name, e.g. Cloudflare=%s", src.path, src.path)
+		}
+		sc := bufio.NewScanner(bytes.NewReader(trimmed))
+		for line := 1; sc.Scan() && err == nil; line++ {
+			text := strings.TrimSpace(sc.Text())
+			if text == "" || text[0] == '#' {
+				continue
+			}
+			if err = add(text, cloudRange{Label: src.name}); err != nil {
+				err = fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if err == nil {
+			err = sc.Err()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", src.path, err)
+	}
+	if c.len() == before {
+		return fmt.Errorf("%s: no prefixes found", src.path)
+	}
+	return nil
+}
+
+// isCSV reports whether the first non-comment line has several fields.
+func isCSV(data []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && line[0] != '#' {
+			return strings.Contains(line, ",")
+		}
+	}
+	return false
+}
+
+func parseCloudRangeJSON(data []byte, add func(string, cloudRange) error) error {
+	var doc cloudRangeDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, p := range doc.Prefixes {
+		var cidr string
+		var r cloudRange
+		switch {
+		case p.IPPrefix != "": // AWS
+			service := p.Service
+			if service == "AMAZON" {
+				service, r.Generic = "", true
+			}
+			cidr, r.Label = p.IPPrefix, label("AWS", service, p.Region)
+		default: // GCP
+			cidr = firstNonEmpty(p.IPv4Prefix, p.IPv6Prefix)
+			r.Label = label(firstNonEmpty(p.Service, "Google Cloud"), p.Scope)
+		}
+		if err := add(cidr, r); err != nil {
+			return err
+		}
+	}
+	for _, p := range doc.IPv6Prefixes {
+		r := cloudRange{Label: label("AWS", p.Service, p.Region)}
+		if p.Service == "AMAZON" {
+			r = cloudRange{Label: label("AWS", p.Region), Generic: true}
+		}
+		if err := add(p.IPv6Prefix, r); err != nil {
+			return err
+		}
+	}
+	for _, v := range doc.Values {
+		service, _, _ := strings.Cut(v.Name, ".")
+		r := cloudRange{Generic: v.Properties.SystemService == ""}
+		if !r.Generic {
+			service = v.Properties.SystemService
+		}
+		r.Label = label("Azure", service, v.Properties.Region)
+		for _, cidr := range v.Properties.AddressPrefixes {
+			if err := add(cidr, r); err != nil {
+				return err
+			}
+		}
+	}
+	for _, region := range doc.Regions {
+		for _, c := range region.CIDRs {
+			r := cloudRange{Label: label("Oracle Cloud", strings.Join(c.Tags, "/"), region.Region)}
+			if err := add(c.CIDR, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseCloudRangeCSV(data []byte, name string, add func(string, cloudRange) error) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := r.FieldPos(0)
+		// prefix, country, region, city, postal: label with the most precise location
+		var location string
+		for _, i := range []int{3, 2, 1} {
+			if i < len(rec) && strings.TrimSpace(rec[i]) != "" {
+				location = strings.TrimSpace(rec[i])
+				break
+			}
+		}
+		if err := add(rec[0], cloudRange{Label: label(name, location)}); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// loadCloudRanges indexes the given range files.
+func loadCloudRanges(sources []cloudRangeSource) (*cloudRanges, error) {
+	c := newCloudRanges()
+	for _, src := range sources {
+		if err := parseCloudRangeFile(src, c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// cloudRangeLoader loads CLOUD_RANGE_FILES and reloads them when they change.
+type cloudRangeLoader struct {
+	sources []cloudRangeSource
+	active  atomic.Pointer[cloudRanges]
+
+	mu     sync.Mutex
+	stamps []fileStamp // stamps of the files as last seen, parallel to sources
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// newCloudRangeLoader loads the range files. If a file is missing or invalid
+// no cloud ranges are active until a reload succeeds. With reloadInterval > 0
+// the files are checked periodically.
+func newCloudRangeLoader(entries []string, reloadInterval time.Duration) *cloudRangeLoader {
+	l := &cloudRangeLoader{
+		stamps: make([]fileStamp, len(entries)),
+		stopCh: make(chan struct{}),
+	}
+	l.active.Store(newCloudRanges())
+	for _, e := range entries {
+		l.sources = append(l.sources, parseCloudRangeSource(e))
+	}
+	if err := l.Reload(); err != nil {
+		log.Printf("[cloud-ranges] %v", err)
+	}
+	if reloadInterval > 0 {
+		go l.watch(reloadInterval)
+	}
+	return l
+}
+
+// Reload reads all files again and swaps in the new index. On error the
+// current index stays active.
+func (l *cloudRangeLoader) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths := make([]string, len(l.sources))
+	for i, src := range l.sources {
+		l.stamps[i] = statFile(src.path)
+		paths[i] = src.path
+	}
+	ranges, err := loadCloudRanges(l.sources)
+	if err != nil {
+		return err
+	}
+	l.active.Store(ranges)
+	log.Printf("[cloud-ranges] Loaded %d prefixes from %s", ranges.len(), strings.Join(paths, ", "))
+	return nil
+}
+
+// match looks ip up in the active index. A nil loader has no ranges.
+func (l *cloudRangeLoader) match(ip string) (cloudRange, bool) {
+	if l == nil {
+		return cloudRange{}, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return cloudRange{}, false
+	}
+	return l.active.Load().match(addr)
+}
+
+// changed reports whether any file differs from when it was last loaded.
+func (l *cloudRangeLoader) changed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, src := range l.sources {
+		if !statFile(src.path).equal(l.stamps[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *cloudRangeLoader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !l.changed() {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				log.Printf("[cloud-ranges] Reload failed, keeping current ranges: %v", err)
+			}
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// Close stops the file watcher.
+func (l *cloudRangeLoader) Close() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stopCh) })
+}
@@ -0,0 +1,135 @@
+package lookup
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCloudRangeFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"aws.json": `{"syncToken":"1","prefixes":[
+			{"ip_prefix":"3.0.0.0/15","region":"us-east-1","service":"AMAZON"},
+			{"ip_prefix":"3.0.0.0/15","region":"us-east-1","service":"EC2"},
+			{"ip_prefix":"3.2.0.0/16","region":"eu-west-1","service":"AMAZON"}],
+			"ipv6_prefixes":[{"ipv6_prefix":"2600:1f00::/24","region":"us-west-2","service":"EC2"}]}`,
+		"gcp.json": `{"creationTime":"2026-10-16","prefixes":[
+			{"ipv4Prefix":"34.0.0.0/20","service":"Google Cloud","scope":"us-central1"},
+			{"ipv6Prefix":"2600:1900::/35","service":"Google Cloud","scope":"us-east1"}]}`,
+		"azure.json": `{"cloud":"Public","values":[
+			{"name":"AzureCloud.eastus","properties":{"region":"eastus","systemService":"","addressPrefixes":["20.42.0.0/16"]}},
+			{"name":"Storage.EastUS","properties":{"region":"eastus","systemService":"AzureStorage","addressPrefixes":["20.42.0.0/16"]}}]}`,
+		"oracle.json": `{"last_updated_timestamp":"2026-10-16","regions":[
+			{"region":"us-phoenix-1","cidrs":[{"cidr":"129.146.0.0/21","tags":["OCI"]}]}]}`,
+		"do.csv": "5.101.96.0/21,NL,NL-NH,Amsterdam,1098\n45.55.0.0/19,US,US-NY,,10011\n",
+		"cf-v4":  "173.245.48.0/20\n103.21.244.0/22\n",
+	}
+	var sources []cloudRangeSource
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, content)
+		src := cloudRangeSource{path: path}
+		if name == "cf-v4" {
+			src.name = "Cloudflare"
+		}
+		sources = append(sources, src)
+	}
+	ranges, err := loadCloudRanges(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, want := range map[string]string{
+		"3.0.1.1":        "AWS EC2 us-east-1", // specific service beats AMAZON
+		"3.2.0.1":        "AWS eu-west-1",
+		"2600:1f00::1":   "AWS EC2 us-west-2",
+		"34.0.1.1":       "Google Cloud us-central1",
+		"2600:1900::1":   "Google Cloud us-east1",
+		"20.42.1.1":      "Azure AzureStorage eastus",
+		"129.146.1.1":    "Oracle Cloud OCI us-phoenix-1",
+		"5.101.96.1":     "DigitalOcean Amsterdam",
+		"45.55.0.1":      "DigitalOcean US-NY",
+		"173.245.48.1":   "Cloudflare",
+		"::ffff:3.0.1.1": "AWS EC2 us-east-1",
+	} {
+		r, ok := ranges.match(netip.MustParseAddr(ip))
+		if !ok || r.Label != want {
+			t.Errorf("match(%s) = %q, %v, want %q", ip, r.Label, ok, want)
+		}
+	}
+	if _, ok := ranges.match(netip.MustParseAddr("8.8.8.8")); ok {
+		t.Error("8.8.8.8 should not match")
+	}
+}
+
+func TestCloudRangeFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]struct {
+		name, content, wantErr string
+	}{
+		"unnamed plain list": {"ips-v4", "173.245.48.0/20\n", "needs a name"},
+		"bad cidr":           {"bad.json", `{"prefixes":[{"ip_prefix":"3.0.0.0/99","service":"EC2"}]}`, "invalid CIDR"},
+		"empty":              {"empty.json", `{"prefixes":[]}`, "no prefixes"},
+	}
+	for name, tc := range cases {
+		path := filepath.Join(dir, tc.name)
+		writeFile(t, path, tc.content)
+		err := parseCloudRangeFile(cloudRangeSource{path: path}, newCloudRanges())
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: err = %v, want containing %q", name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLocalDBMarksCloudRange(t *testing.T) {
+	dir := t.TempDir()
+	mmdb := filepath.Join(dir, "asn.mmdb")
+	asnDB(1700000000, 64500, "Shared Networks").write(t, mmdb)
+	ranges := filepath.Join(dir, "ranges.json")
+	writeFile(t, ranges, `{"prefixes":[{"ipv4Prefix":"203.0.113.128/25","service":"Google Cloud","scope":"europe-west3"}]}`)
+
+	l := newCloudRangeLoader([]string{ranges}, 0)
+	defer l.Close()
+	db := NewLocalDB([]string{mmdb}, 0)
+	defer db.Close()
+
+	info, err := db.Lookup("203.0.113.200", l, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDatacenter || info.CloudService != "Google Cloud europe-west3" || info.UsageType != "cloud" {
+		t.Fatalf("got datacenter=%v service=%q usage=%q", info.IsDatacenter, info.CloudService, info.UsageType)
+	}
+	if info.Provenance["is_datacenter"] != SourceCloudRanges {
+		t.Errorf("provenance = %v", info.Provenance)
+	}
+
+	// Same ASN outside the published range
+	info, err = db.Lookup("203.0.113.10", l, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDatacenter || info.CloudService != "" {
+		t.Fatalf("unpublished IP: datacenter=%v service=%q", info.IsDatacenter, info.CloudService)
+	}
+}
+
+func TestLookupMarksCloudRangeWithoutMMDB(t *testing.T) {
+	ranges := filepath.Join(t.TempDir(), "ranges.json")
+	writeFile(t, ranges, `{"prefixes":[{"ipv4Prefix":"93.184.113.128/25","service":"Google Cloud","scope":"europe-west3"}]}`)
+	l := newCloudRangeLoader([]string{ranges}, 0)
+	defer l.Close()
+
+	svc := newTestService(t) // no MMDB, no providers
+	svc.ranges = l
+	info, err := svc.Lookup(context.Background(), "93.184.113.200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDatacenter || info.CloudService != "Google Cloud europe-west3" || info.Source != "local" {
+		t.Fatalf("got datacenter=%v service=%q source=%q", info.IsDatacenter, info.CloudService, info.Source)
+	}
+}
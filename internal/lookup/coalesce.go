@@ -0,0 +1,84 @@
+package lookup
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// flightGroup coalesces concurrent lookups of the same IP so that only one
+// provider chain runs per IP at a time and every caller shares its result.
+//
+// The shared lookup runs on a context detached from any single caller and is
+// canceled only once every waiting caller has gone away, so one client
+// disconnecting does not fail the lookup for the others.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+
+	coalesced atomic.Int64 // callers served by a lookup started by someone else
+}
+
+type flight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // guarded by flightGroup.mu
+
+	info *model.IPInfo
+	err  error
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flight)}
+}
+
+// do runs fn once per key for all concurrent callers and waits for the result
+// or for ctx to be done, whichever comes first.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*model.IPInfo, error)) (*model.IPInfo, error) {
+	g.mu.Lock()
+	f, ok := g.calls[key]
+	if ok && f.waiters > 0 {
+		f.waiters++
+		g.mu.Unlock()
+		g.coalesced.Add(1)
+	} else {
+		// No flight, or one already canceled because all its callers left
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		g.calls[key] = f
+		g.mu.Unlock()
+
+		go func() {
+			f.info, f.err = fn(flightCtx)
+			g.mu.Lock()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+
+	select {
+	case <-f.done:
+		return f.info, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// inFlight returns the number of lookups currently running.
+func (g *flightGroup) inFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
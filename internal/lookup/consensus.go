@@ -0,0 +1,185 @@
+package lookup
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// consensusFlag describes one boolean flag that providers vote on.
+type consensusFlag struct {
+	name   string // JSON field name, used as key in model.Consensus.Flags
+	detect Capability
+	get    func(*model.IPInfo) bool
+	set    func(*model.IPInfo, bool)
+}
+
+var consensusFlags = []consensusFlag{
+	{"is_datacenter", DetectsDatacenter,
+		func(i *model.IPInfo) bool { return i.IsDatacenter }, func(i *model.IPInfo, v bool) { i.IsDatacenter = v }},
+	{"is_proxy", DetectsProxy,
+		func(i *model.IPInfo) bool { return i.IsProxy }, func(i *model.IPInfo, v bool) { i.IsProxy = v }},
+	{"is_vpn", DetectsVPN,
+		func(i *model.IPInfo) bool { return i.IsVPN }, func(i *model.IPInfo, v bool) { i.IsVPN = v }},
+	{"is_tor", DetectsTor,
+		func(i *model.IPInfo) bool { return i.IsTor }, func(i *model.IPInfo, v bool) { i.IsTor = v }},
+}
+
+// providerAnswer is a successful response from one provider.
+type providerAnswer struct {
+	provider Provider
+	info     *model.IPInfo
+}
+
+// queryConsensus queries up to s.consensusN providers concurrently and merges
+// their answers by weighted vote. Providers that fail are replaced by the next
+// available ones in chain order until enough answers are collected or the
+// chain is exhausted or ctx is done.
+func (s *Service) queryConsensus(ctx context.Context, ip string) *model.IPInfo {
+	var answers []providerAnswer
+	next := 0
+
+	for len(answers) < s.consensusN && next < len(s.providers) && ctx.Err() == nil {
+		var batch []*chainProvider
+		for next < len(s.providers) && len(answers)+len(batch) < s.consensusN {
+			p := s.providers[next]
+			next++
+			if p.Acquire() {
+				batch = append(batch, p)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		results := make([]*model.IPInfo, len(batch))
+		var wg sync.WaitGroup
+		for i, p := range batch {
+			wg.Add(1)
+			go func(i int, p *chainProvider) {
+				defer wg.Done()
+				info, err := p.query(ctx, ip)
+				if err != nil {
+					log.Printf("[provider] %s failed for %s: %v", p.Name(), ip, err)
+					return
+				}
+				results[i] = info
+			}(i, p)
+		}
+		wg.Wait()
+
+		for i, info := range results {
+			if info != nil {
+				answers = append(answers, providerAnswer{provider: batch[i].Provider, info: info})
+			}
+		}
+	}
+
+	if len(answers) == 0 {
+		log.Printf("[lookup] %s → all providers exhausted", ip)
+		return nil
+	}
+
+	merged := mergeConsensus(ip, answers, s.weights, s.quorum)
+	log.Printf("[lookup] %s → consensus of %v (datacenter=%v proxy=%v vpn=%v)",
+		ip, merged.Consensus.Providers, merged.IsDatacenter, merged.IsProxy, merged.IsVPN)
+	return merged
+}
+
+// mergeConsensus combines provider answers into one result.
+// Descriptive fields (ASN, ISP, geo) come from the first answer that has them,
+// so chain order still decides priority. Each security flag is set when the
+// weighted share of "true" votes among providers able to report it exceeds
+// quorum. Providers with a weight <= 0 do not vote.
+func mergeConsensus(ip string, answers []providerAnswer, weights map[string]float64, quorum float64) *model.IPInfo {
+	merged := &model.IPInfo{IP: ip, Source: SourceConsensus}
+	consensus := &model.Consensus{Flags: make(map[string]model.FlagVote)}
+
+	for _, a := range answers {
+		consensus.Providers = append(consensus.Providers, a.provider.Name())
+		fillMissing(merged, a.info, a.provider.Name())
+	}
+
+	for _, f := range consensusFlags {
+		var yesWeight, totalWeight float64
+		var yes, voters int
+		for _, a := range answers {
+			if a.provider.Capabilities()&f.detect == 0 {
+				continue
+			}
+			w := 1.0
+			if cw, ok := weights[a.provider.Name()]; ok {
+				w = cw
+			}
+			if w <= 0 {
+				continue
+			}
+			voters++
+			totalWeight += w
+			if f.get(a.info) {
+				yes++
+				yesWeight += w
+			}
+		}
+		if voters == 0 {
+			continue
+		}
+
+		value := yesWeight > quorum*totalWeight
+		f.set(merged, value)
+		agreed, agreedWeight := voters-yes, totalWeight-yesWeight
+		if value {
+			agreed, agreedWeight = yes, yesWeight
+		}
+		consensus.Flags[f.name] = model.FlagVote{Agreed: agreed, Voters: voters}
+		setProvenance(merged, SourceConsensus, f.name)
+		setConfidence(merged, f.name, agreedWeight/totalWeight)
+	}
+
+	merged.Consensus = consensus
+	return merged
+}
+
+// fillMissing copies descriptive fields from src into dst where dst is empty,
+// recording source as their provenance.
+func fillMissing(dst, src *model.IPInfo, source string) {
+	if dst.ASN == 0 && src.ASN != 0 {
+		dst.ASN = src.ASN
+		dst.ASNOrg = src.ASNOrg
+		setProvenance(dst, source, "asn", "asn_org")
+	}
+	if dst.ISP == "" && src.ISP != "" {
+		dst.ISP = src.ISP
+		setProvenance(dst, source, "isp")
+	}
+	if dst.UsageType == "" && src.UsageType != "" {
+		dst.UsageType = src.UsageType
+		setProvenance(dst, source, "usage_type")
+	}
+	if dst.Country == "" && src.Country != "" {
+		dst.Country = src.Country
+		setProvenance(dst, source, "country")
+	}
+	if dst.CountryCode == "" && src.CountryCode != "" {
+		dst.CountryCode = src.CountryCode
+		setProvenance(dst, source, "country_code")
+	}
+	if dst.City == "" && src.City != "" {
+		dst.City = src.City
+		setProvenance(dst, source, "city")
+	}
+	if dst.Region == "" && src.Region != "" {
+		dst.Region = src.Region
+		setProvenance(dst, source, "region")
+	}
+	if dst.Latitude == 0 && dst.Longitude == 0 && (src.Latitude != 0 || src.Longitude != 0) {
+		dst.Latitude, dst.Longitude = src.Latitude, src.Longitude
+		setProvenance(dst, source, "latitude", "longitude")
+	}
+	if dst.Timezone == "" && src.Timezone != "" {
+		dst.Timezone = src.Timezone
+		setProvenance(dst, source, "timezone")
+	}
+}
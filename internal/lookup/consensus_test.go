@@ -0,0 +1,61 @@
+package lookup
+
+import (
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestMergeConsensusVotesPerFlag(t *testing.T) {
+	ipAPI := &FuncProvider{ProviderName: "ip-api", Detects: DetectsDatacenter | DetectsProxy}
+	ipwhois := &FuncProvider{ProviderName: "ipwhois", Detects: DetectsDatacenter | DetectsProxy | DetectsVPN | DetectsTor}
+	freeipapi := &FuncProvider{ProviderName: "freeipapi", Detects: DetectsProxy}
+
+	answers := []providerAnswer{
+		{ipAPI, &model.IPInfo{IsDatacenter: true, ASN: 16509, ASNOrg: "Amazon", Country: "United States"}},
+		{ipwhois, &model.IPInfo{IsDatacenter: false, IsProxy: true, City: "Ashburn"}},
+		{freeipapi, &model.IPInfo{IsProxy: true, Country: "Ignored"}},
+	}
+
+	got := mergeConsensus("1.2.3.4", answers, nil, 0.5)
+
+	// 1 of 2 datacenter voters is not a strict majority.
+	if got.IsDatacenter {
+		t.Error("is_datacenter should be false on a tie")
+	}
+	if !got.IsProxy {
+		t.Error("is_proxy should be true with 2 of 3 votes")
+	}
+	if v := got.Consensus.Flags["is_proxy"]; v.Agreed != 2 || v.Voters != 3 {
+		t.Errorf("is_proxy vote = %+v, want 2/3", v)
+	}
+	if v := got.Consensus.Flags["is_vpn"]; v.Agreed != 1 || v.Voters != 1 {
+		t.Errorf("is_vpn vote = %+v, want 1/1", v)
+	}
+	if got.ASN != 16509 || got.Country != "United States" || got.City != "Ashburn" {
+		t.Errorf("descriptive fields not merged in chain order: %+v", got)
+	}
+}
+
+func TestMergeConsensusUsesWeights(t *testing.T) {
+	ipAPI := &FuncProvider{ProviderName: "ip-api", Detects: DetectsDatacenter}
+	ipwhois := &FuncProvider{ProviderName: "ipwhois", Detects: DetectsDatacenter}
+
+	answers := []providerAnswer{
+		{ipAPI, &model.IPInfo{IsDatacenter: true}},
+		{ipwhois, &model.IPInfo{IsDatacenter: false}},
+	}
+
+	got := mergeConsensus("1.2.3.4", answers, map[string]float64{"ip-api": 2}, 0.5)
+	if !got.IsDatacenter {
+		t.Error("is_datacenter should follow the heavier provider")
+	}
+
+	got = mergeConsensus("1.2.3.4", answers, map[string]float64{"ip-api": 0}, 0.5)
+	if got.IsDatacenter {
+		t.Error("provider with zero weight should not vote")
+	}
+	if v := got.Consensus.Flags["is_datacenter"]; v.Voters != 1 {
+		t.Errorf("voters = %d, want 1", v.Voters)
+	}
+}
@@ -0,0 +1,301 @@
+package lookup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// declarativeFile is the format of PROVIDERS_FILE.
+//
+//	{
+//	  "providers": [{
+//	    "name": "enrich",
+//	    "url": "https://enrich.internal/v1/{ip}?key={key}",
+//	    "key_env": "ENRICH_KEY",
+//	    "headers": {"Accept": "application/json"},
+//	    "rate_limit": 100,
+//	    "success": "status=success",
+//	    "error_field": "message",
+//	    "fields": {
+//	      "is_datacenter": "security.hosting|asn.type=hosting",
+//	      "is_proxy": "security.proxy|security.anonymous",
+//	      "asn": "asn.asn",
+//	      "country_code": "country_code"
+//	    }
+//	  }]
+//	}
+//
+// Field expressions are dot-separated JSON paths (numeric segments index
+// arrays). Alternatives are separated by "|": boolean fields are true if any
+// alternative is truthy, other fields take the first non-empty alternative.
+// "path=value" compares the value at path as a string.
+type declarativeFile struct {
+	Providers []declarativeSpec `json:"providers"`
+}
+
+type declarativeSpec struct {
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`     // must contain {ip}, may contain {key}
+	Key        string            `json:"key"`     // API key substituted for {key}
+	KeyEnv     string            `json:"key_env"` // env var to read the key from, overrides Key
+	Headers    map[string]string `json:"headers"` // values may contain {key}
+	RateLimit  int               `json:"rate_limit"`
+	Timeout    string            `json:"timeout"`     // e.g. "3s", default is the shared HTTP client timeout
+	Success    string            `json:"success"`     // boolean expression, response is an error when false
+	ErrorField string            `json:"error_field"` // path of the error message when Success is false
+	Fields     map[string]string `json:"fields"`      // IPInfo JSON field name → expression
+}
+
+// declarativeBoolFields maps boolean IPInfo fields to the capability they imply.
+var declarativeBoolFields = map[string]Capability{
+	"is_datacenter": DetectsDatacenter,
+	"is_proxy":      DetectsProxy,
+	"is_vpn":        DetectsVPN,
+	"is_tor":        DetectsTor,
+}
+
+var declarativeStringFields = map[string]bool{
+	"asn": true, "asn_org": true, "isp": true, "usage_type": true,
+	"country": true, "country_code": true, "city": true,
+}
+
+// httpJSONProvider is a Provider defined entirely by a declarativeSpec.
+type httpJSONProvider struct {
+	spec    declarativeSpec
+	key     string
+	timeout time.Duration
+	detects Capability
+	quota   Quota
+}
+
+// loadDeclarativeProviders reads and validates PROVIDERS_FILE.
+func loadDeclarativeProviders(path string) ([]Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file declarativeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	providers := make([]Provider, 0, len(file.Providers))
+	seen := make(map[string]bool)
+	for i, spec := range file.Providers {
+		p, err := newHTTPJSONProvider(spec)
+		if err != nil {
+			return nil, fmt.Errorf("provider #%d: %w", i+1, err)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("provider %q defined twice", spec.Name)
+		}
+		seen[spec.Name] = true
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+func newHTTPJSONProvider(spec declarativeSpec) (*httpJSONProvider, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	if !strings.Contains(spec.URL, "{ip}") {
+		return nil, fmt.Errorf("%s: url must contain {ip}", spec.Name)
+	}
+	if len(spec.Fields) == 0 {
+		return nil, fmt.Errorf("%s: no fields mapped", spec.Name)
+	}
+
+	p := &httpJSONProvider{spec: spec, key: spec.Key}
+	if spec.KeyEnv != "" {
+		p.key = os.Getenv(spec.KeyEnv)
+	}
+	if spec.Timeout != "" {
+		d, err := time.ParseDuration(spec.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid timeout: %w", spec.Name, err)
+		}
+		p.timeout = d
+	}
+
+	for field := range spec.Fields {
+		if c, ok := declarativeBoolFields[field]; ok {
+			p.detects |= c
+		} else if !declarativeStringFields[field] {
+			return nil, fmt.Errorf("%s: unknown field %q", spec.Name, field)
+		}
+	}
+
+	needsKey := strings.Contains(spec.URL, "{key}")
+	for _, v := range spec.Headers {
+		needsKey = needsKey || strings.Contains(v, "{key}")
+	}
+	p.quota = Quota{
+		PerMinute: spec.RateLimit,
+		NeedsKey:  needsKey,
+		HasKey:    !needsKey || p.key != "",
+	}
+	return p, nil
+}
+
+func (p *httpJSONProvider) Name() string             { return p.spec.Name }
+func (p *httpJSONProvider) Capabilities() Capability { return p.detects }
+func (p *httpJSONProvider) Quota() Quota             { return p.quota }
+
+func (p *httpJSONProvider) Query(ctx context.Context, ip string) (*model.IPInfo, error) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	url := strings.NewReplacer("{ip}", ip, "{key}", p.key).Replace(p.spec.URL)
+	headers := make(map[string]string, len(p.spec.Headers))
+	for k, v := range p.spec.Headers {
+		headers[k] = strings.ReplaceAll(v, "{key}", p.key)
+	}
+
+	var doc interface{}
+	if err := fetchJSONWithHeaders(ctx, url, headers, &doc); err != nil {
+		return nil, err
+	}
+
+	if p.spec.Success != "" && !evalBool(doc, p.spec.Success) {
+		msg := "unsuccessful response"
+		if p.spec.ErrorField != "" {
+			if m := evalString(doc, p.spec.ErrorField); m != "" {
+				msg = m
+			}
+		}
+		return nil, fmt.Errorf("%s error: %s", p.spec.Name, msg)
+	}
+
+	info := &model.IPInfo{IP: ip, Source: p.spec.Name}
+	for field, expr := range p.spec.Fields {
+		switch field {
+		case "is_datacenter":
+			info.IsDatacenter = evalBool(doc, expr)
+		case "is_proxy":
+			info.IsProxy = evalBool(doc, expr)
+		case "is_vpn":
+			info.IsVPN = evalBool(doc, expr)
+		case "is_tor":
+			info.IsTor = evalBool(doc, expr)
+		case "asn":
+			info.ASN = parseASN(evalString(doc, expr))
+		case "asn_org":
+			info.ASNOrg = evalString(doc, expr)
+		case "isp":
+			info.ISP = evalString(doc, expr)
+		case "country":
+			info.Country = evalString(doc, expr)
+		case "country_code":
+			info.CountryCode = evalString(doc, expr)
+		case "city":
+			info.City = evalString(doc, expr)
+		case "usage_type":
+			info.UsageType = normalizeUsageType(evalString(doc, expr))
+		}
+	}
+	return info, nil
+}
+
+// normalizeUsageType returns s as a known usage type, e.g. "Hosting" →
+// "hosting", or "" if it is none of them.
+func normalizeUsageType(s string) string {
+	u := UsageType(strings.ToLower(strings.TrimSpace(s)))
+	if !u.Valid() {
+		return ""
+	}
+	return string(u)
+}
+
+// evalBool returns true if any "|"-separated alternative is truthy.
+func evalBool(doc interface{}, expr string) bool {
+	for _, alt := range strings.Split(expr, "|") {
+		path, want, isCompare := strings.Cut(strings.TrimSpace(alt), "=")
+		v, ok := jsonPath(doc, path)
+		if !ok {
+			continue
+		}
+		if isCompare {
+			if jsonString(v) == want {
+				return true
+			}
+		} else if jsonTruthy(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalString returns the first non-empty "|"-separated alternative.
+func evalString(doc interface{}, expr string) string {
+	for _, alt := range strings.Split(expr, "|") {
+		if v, ok := jsonPath(doc, strings.TrimSpace(alt)); ok {
+			if s := jsonString(v); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// jsonPath walks a decoded JSON document along a dot-separated path.
+func jsonPath(doc interface{}, path string) (interface{}, bool) {
+	cur := doc
+	for _, seg := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func jsonString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		return ""
+	}
+}
+
+func jsonTruthy(v interface{}) bool {
+	switch x := v.(type) {
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		switch strings.ToLower(x) {
+		case "true", "yes", "1":
+			return true
+		}
+	}
+	return false
+}
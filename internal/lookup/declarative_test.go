@@ -0,0 +1,118 @@
+package lookup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeclarativeProviderMapsFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/v1/203.0.113.9" {
+			w.Write([]byte(`{"status":"fail","message":"reserved range"}`))
+			return
+		}
+		w.Write([]byte(`{
+			"status": "success",
+			"asn": {"number": "AS16509", "name": "Amazon.com, Inc.", "type": "hosting"},
+			"security": {"proxy": 0, "vpn": "yes"},
+			"location": {"country": "United States", "code": "US", "cities": ["Ashburn"]}
+		}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "providers.json")
+	writeFile(t, path, `{"providers": [{
+		"name": "enrich",
+		"url": "`+srv.URL+`/v1/{ip}",
+		"key": "secret",
+		"headers": {"X-Api-Key": "{key}"},
+		"rate_limit": 10,
+		"success": "status=success",
+		"error_field": "message",
+		"fields": {
+			"is_datacenter": "security.hosting|asn.type=hosting",
+			"is_proxy": "security.proxy",
+			"is_vpn": "security.vpn",
+			"asn": "asn.number",
+			"asn_org": "asn.name",
+			"country": "location.country",
+			"country_code": "location.code",
+			"city": "location.cities.0",
+			"usage_type": "asn.type"
+		}
+	}]}`)
+
+	providers, err := loadDeclarativeProviders(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	p := providers[0]
+
+	if got := p.Capabilities(); got != DetectsDatacenter|DetectsProxy|DetectsVPN {
+		t.Errorf("capabilities = %v", got.Names())
+	}
+	if q := p.Quota(); q.PerMinute != 10 || !q.NeedsKey || !q.HasKey {
+		t.Errorf("quota = %+v", q)
+	}
+
+	info, err := p.Query(context.Background(), "198.51.100.7")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if !info.IsDatacenter || info.IsProxy || !info.IsVPN {
+		t.Errorf("flags = datacenter:%v proxy:%v vpn:%v", info.IsDatacenter, info.IsProxy, info.IsVPN)
+	}
+	if info.ASN != 16509 || info.ASNOrg != "Amazon.com, Inc." || info.City != "Ashburn" || info.CountryCode != "US" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if info.UsageType != "hosting" {
+		t.Errorf("usage_type = %q, want hosting", info.UsageType)
+	}
+	if info.Source != "enrich" {
+		t.Errorf("source = %q", info.Source)
+	}
+
+	_, err = p.Query(context.Background(), "203.0.113.9")
+	if err == nil || !strings.Contains(err.Error(), "reserved range") {
+		t.Errorf("expected success check to fail with message, got %v", err)
+	}
+}
+
+func TestNormalizeUsageType(t *testing.T) {
+	for in, want := range map[string]string{
+		"hosting":  "hosting",
+		" Mobile ": "mobile",
+		"business": "",
+		"":         "",
+	} {
+		if got := normalizeUsageType(in); got != want {
+			t.Errorf("normalizeUsageType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDeclarativeProviderRejectsUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.json")
+	writeFile(t, path, `{"providers": [{"name": "x", "url": "http://x/{ip}", "fields": {"hosting": "a"}}]}`)
+
+	if _, err := loadDeclarativeProviders(path); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
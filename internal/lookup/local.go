@@ -5,78 +5,341 @@ import (
 	"log"
 	"net"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/akl7777777/ip-intel/internal/model"
 	"github.com/oschwald/maxminddb-golang"
 )
 
 // LocalDB handles MMDB-based local IP lookups.
+// It reads an ASN database plus optional City/Country databases. Readers can
+// be swapped at runtime (see Reload); lookups hold a read lock, so in-flight
+// lookups finish on the old reader before it is closed.
 type LocalDB struct {
-	reader *maxminddb.Reader
+	mu    sync.RWMutex
+	files []*mmdbFile // ASN database first, then geo databases in priority order
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// mmdbFile is one MMDB file. Fields other than path are guarded by LocalDB.mu.
+type mmdbFile struct {
+	path    string
+	reader  *maxminddb.Reader // nil until the file has been loaded
+	modTime time.Time
+	size    int64
 }
 
-// mmdbRecord maps the fields in a GeoLite2-ASN MMDB.
+// mmdbNames holds localized names, e.g. {"en": "Germany"}.
+type mmdbNames map[string]string
+
+func (n mmdbNames) en() string { return n["en"] }
+
+// mmdbRecord maps the fields of the supported MMDB layouts: GeoLite2-ASN,
+// GeoLite2-City / GeoLite2-Country, and the flat sapics ip-location-db
+// databases (geo-whois-asn-country, dbip-city, ...). Fields absent from a
+// database stay zero.
 type mmdbRecord struct {
 	AutonomousSystemNumber       int    `maxminddb:"autonomous_system_number"`
 	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+
+	// GeoLite2-City / GeoLite2-Country
+	Country struct {
+		ISOCode string    `maxminddb:"iso_code"`
+		Names   mmdbNames `maxminddb:"names"`
+	} `maxminddb:"country"`
+	// City is {"names": {...}} in GeoLite2-City but a plain string in the
+	// sapics layout, so it is decoded generically.
+	City         interface{} `maxminddb:"city"`
+	Subdivisions []struct {
+		Names mmdbNames `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+
+	// sapics ip-location-db flat layout
+	CountryCode string  `maxminddb:"country_code"`
+	State       string  `maxminddb:"state1"`
+	Latitude    float64 `maxminddb:"latitude"`
+	Longitude   float64 `maxminddb:"longitude"`
+	Timezone    string  `maxminddb:"timezone"`
+}
+
+// cityName returns the English city name from either layout.
+func (r *mmdbRecord) cityName() string {
+	switch c := r.City.(type) {
+	case string:
+		return c
+	case map[string]interface{}:
+		if names, ok := c["names"].(map[string]interface{}); ok {
+			name, _ := names["en"].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+// NewLocalDB tries to open the MMDB files, the ASN database first. A missing
+// or invalid file is skipped until a later reload succeeds; local lookup is
+// disabled while no file is loaded.
+// With reloadInterval > 0 the files are checked periodically and reloaded
+// when their modification time or size changes.
+func NewLocalDB(paths []string, reloadInterval time.Duration) *LocalDB {
+	db := &LocalDB{stopCh: make(chan struct{})}
+	for _, path := range paths {
+		f := &mmdbFile{path: path}
+		db.files = append(db.files, f)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			log.Printf("[local] MMDB file not found at %s, skipped", path)
+		} else if err := db.reload(f); err != nil {
+			log.Printf("[local] Failed to open MMDB %s: %v, skipped", path, err)
+		}
+	}
+
+	if reloadInterval > 0 {
+		go db.watch(reloadInterval)
+	}
+	return db
+}
+
+// Loaded reports whether at least one MMDB file is currently loaded.
+func (db *LocalDB) Loaded() bool {
+	if db == nil {
+		return false
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, f := range db.files {
+		if f.reader != nil {
+			return true
+		}
+	}
+	return false
 }
 
-// NewLocalDB tries to open the MMDB file. Returns nil if not available.
-func NewLocalDB(path string) *LocalDB {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		log.Printf("[local] MMDB file not found at %s, local lookup disabled", path)
-		return nil
+// BuildEpoch returns the build time of the first loaded database (normally
+// the ASN database), zero if none.
+func (db *LocalDB) BuildEpoch() time.Time {
+	if db == nil {
+		return time.Time{}
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, f := range db.files {
+		if f.reader != nil {
+			return time.Unix(int64(f.reader.Metadata.BuildEpoch), 0).UTC()
+		}
 	}
+	return time.Time{}
+}
 
-	reader, err := maxminddb.Open(path)
+// Reload opens every MMDB file again and atomically swaps it in. A file that
+// fails to open keeps its current reader; the first error is returned.
+func (db *LocalDB) Reload() error {
+	var firstErr error
+	for _, f := range db.files {
+		if err := db.reload(f); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+	return firstErr
+}
+
+// reload opens f again and swaps it in. The old reader is closed once
+// in-flight lookups have released it. On error the current reader stays in use.
+func (db *LocalDB) reload(f *mmdbFile) error {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.Open(f.path)
 	if err != nil {
-		log.Printf("[local] Failed to open MMDB: %v, local lookup disabled", err)
-		return nil
+		return err
+	}
+
+	db.mu.Lock()
+	old := f.reader
+	f.reader = reader
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	db.mu.Unlock()
+
+	if old != nil {
+		old.Close()
 	}
 
-	log.Printf("[local] Loaded MMDB: %s", path)
-	return &LocalDB{reader: reader}
+	log.Printf("[local] Loaded MMDB: %s (%s, build %s)", f.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format(time.RFC3339))
+	return nil
 }
 
-// Lookup queries the local MMDB for ASN info, then checks the datacenter ASN list.
-func (db *LocalDB) Lookup(ipStr string) (*model.IPInfo, error) {
+// watch reloads a file whenever its modification time or size changes.
+func (db *LocalDB) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, f := range db.files {
+				fi, err := os.Stat(f.path)
+				if err != nil {
+					continue
+				}
+				db.mu.RLock()
+				changed := !fi.ModTime().Equal(f.modTime) || fi.Size() != f.size
+				db.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				if err := db.reload(f); err != nil {
+					log.Printf("[local] MMDB reload of %s failed, keeping current database: %v", f.path, err)
+				}
+			}
+		case <-db.stopCh:
+			return
+		}
+	}
+}
+
+// Lookup queries the local MMDB files for ASN and geolocation info, then
+// checks the ASN lists, the organization name with orgs and the published
+// cloud ranges. For each field the first file that has a value wins. A file
+// whose lookup fails is skipped; an error is returned only if no file could
+// answer. ranges and orgs may be nil.
+func (db *LocalDB) Lookup(ipStr string, ranges *cloudRangeLoader, orgs *orgScorer) (*model.IPInfo, error) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		return nil, fmt.Errorf("invalid IP: %s", ipStr)
 	}
 
-	var record mmdbRecord
-	err := db.reader.Lookup(ip, &record)
-	if err != nil {
-		return nil, fmt.Errorf("MMDB lookup failed: %w", err)
-	}
-
 	info := &model.IPInfo{
 		IP:     ipStr,
-		ASN:    record.AutonomousSystemNumber,
-		ASNOrg: record.AutonomousSystemOrganization,
-		ISP:    record.AutonomousSystemOrganization,
 		Source: "local",
 	}
 
+	loaded, answered := false, false
+	var lookupErr error
+	db.mu.RLock()
+	for _, f := range db.files {
+		if f.reader == nil {
+			continue
+		}
+		loaded = true
+		if ip.To4() == nil && f.reader.Metadata.IPVersion == 4 {
+			answered = true // IPv4-only database, nothing to find
+			continue
+		}
+
+		var record mmdbRecord
+		if err := f.reader.Lookup(ip, &record); err != nil {
+			log.Printf("[local] MMDB lookup of %s failed (%s), skipped: %v", ipStr, f.path, err)
+			lookupErr = fmt.Errorf("MMDB lookup failed (%s): %w", f.path, err)
+			continue
+		}
+		answered = true
+		fillFromRecord(info, &record)
+	}
+	db.mu.RUnlock()
+	if !loaded {
+		return nil, fmt.Errorf("MMDB not loaded")
+	}
+	if !answered {
+		return nil, lookupErr
+	}
+	setProvenance(info, SourceMMDB, descriptiveFields(info)...)
+
 	// Check against known datacenter ASN list
-	if org, ok := IsKnownDatacenterASN(record.AutonomousSystemNumber); ok {
-		info.IsDatacenter = true
+	if org, ok := IsKnownDatacenterASN(info.ASN); ok {
+		markDatacenterASN(info)
 		info.ASNOrg = org
+		setProvenance(info, SourceASNList, "asn_org")
 	}
 
 	// Known residential ISP overrides datacenter classification
-	if org, ok := IsKnownResidentialASN(record.AutonomousSystemNumber); ok {
-		info.IsDatacenter = false
-		info.ISP = org
+	if org, ok := IsKnownResidentialASN(info.ASN); ok {
+		markResidentialASN(info, org)
+	}
+	// Education, government, ...
+	setUsageType(info)
+	// Unlisted ASNs: hosting or carrier organization names
+	applyOrgName(info, orgs)
+
+	// Published cloud ranges are more precise than the ASN, which may also
+	// carry non-cloud traffic (e.g. Google's AS15169)
+	if r, ok := ranges.match(ipStr); ok {
+		markCloudRange(info, r)
 	}
 
 	return info, nil
 }
 
-// Close closes the MMDB reader.
+// fillFromRecord copies the fields of one MMDB record into info where info
+// has no value yet.
+func fillFromRecord(info *model.IPInfo, r *mmdbRecord) {
+	if info.ASN == 0 && r.AutonomousSystemNumber != 0 {
+		info.ASN = r.AutonomousSystemNumber
+		info.ASNOrg = r.AutonomousSystemOrganization
+		info.ISP = r.AutonomousSystemOrganization
+	}
+
+	countryCode := firstNonEmpty(r.Country.ISOCode, r.CountryCode)
+	if info.CountryCode == "" && countryCode != "" {
+		info.CountryCode = countryCode
+	}
+	if info.Country == "" {
+		info.Country = r.Country.Names.en()
+	}
+	if info.City == "" {
+		info.City = r.cityName()
+	}
+	if info.Region == "" {
+		if len(r.Subdivisions) > 0 {
+			info.Region = r.Subdivisions[0].Names.en()
+		} else {
+			info.Region = r.State
+		}
+	}
+	if info.Latitude == 0 && info.Longitude == 0 {
+		if r.Location.Latitude != 0 || r.Location.Longitude != 0 {
+			info.Latitude, info.Longitude = r.Location.Latitude, r.Location.Longitude
+		} else {
+			info.Latitude, info.Longitude = r.Latitude, r.Longitude
+		}
+	}
+	if info.Timezone == "" {
+		info.Timezone = firstNonEmpty(r.Location.TimeZone, r.Timezone)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Close stops the file watcher and closes the MMDB readers.
 func (db *LocalDB) Close() {
-	if db != nil && db.reader != nil {
-		db.reader.Close()
+	if db == nil {
+		return
+	}
+	db.stopOnce.Do(func() { close(db.stopCh) })
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, f := range db.files {
+		if f.reader != nil {
+			f.reader.Close()
+			f.reader = nil
+		}
 	}
 }
@@ -0,0 +1,178 @@
+package lookup
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func asnDB(epoch uint64, asn int, org string) testMMDB {
+	return testMMDB{
+		dbType:     "GeoLite2-ASN",
+		buildEpoch: epoch,
+		networks: map[string]map[string]interface{}{
+			"203.0.113.0/24": {
+				"autonomous_system_number":       asn,
+				"autonomous_system_organization": org,
+			},
+		},
+	}
+}
+
+func TestLocalDBHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	asnDB(1700000000, 64500, "Old Networks").write(t, path)
+
+	db := NewLocalDB([]string{path}, 10*time.Millisecond)
+	defer db.Close()
+
+	info, err := db.Lookup("203.0.113.10", nil, nil)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if info.ASN != 64500 {
+		t.Fatalf("ASN = %d, want 64500", info.ASN)
+	}
+
+	asnDB(1800000000, 16509, "Amazon Replacement Build").write(t, path)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err = db.Lookup("203.0.113.10", nil, nil)
+		if err == nil && info.ASN == 16509 {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				t.Fatalf("new database not picked up, last err %v", err)
+			}
+			t.Fatalf("new database not picked up, last ASN %d", info.ASN)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !info.IsDatacenter {
+		t.Error("reloaded ASN should be classified by the datacenter list")
+	}
+	if got := db.BuildEpoch().Unix(); got != 1800000000 {
+		t.Errorf("build epoch = %d, want 1800000000", got)
+	}
+}
+
+func TestLocalDBLoadsFileThatAppearsLater(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+
+	db := NewLocalDB([]string{path}, time.Hour)
+	defer db.Close()
+	if db.Loaded() {
+		t.Fatal("missing file should not be loaded")
+	}
+
+	asnDB(1700000000, 64500, "Late Networks").write(t, path)
+	if err := db.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !db.Loaded() {
+		t.Fatal("database should be loaded after explicit reload")
+	}
+}
+
+func TestLocalDBGeoDatabases(t *testing.T) {
+	dir := t.TempDir()
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	cityPath := filepath.Join(dir, "city.mmdb")
+	countryPath := filepath.Join(dir, "country.mmdb")
+
+	asnDB(1700000000, 3320, "Deutsche Telekom AG").write(t, asnPath)
+	testMMDB{
+		dbType:     "GeoLite2-City",
+		buildEpoch: 1700000000,
+		networks: map[string]map[string]interface{}{
+			"203.0.113.0/24": {
+				"country": map[string]interface{}{
+					"iso_code": "DE",
+					"names":    map[string]interface{}{"en": "Germany", "de": "Deutschland"},
+				},
+				"city":         map[string]interface{}{"names": map[string]interface{}{"en": "Berlin"}},
+				"subdivisions": []interface{}{map[string]interface{}{"names": map[string]interface{}{"en": "Land Berlin"}}},
+				"location": map[string]interface{}{
+					"latitude":  52.52,
+					"longitude": 13.405,
+					"time_zone": "Europe/Berlin",
+				},
+			},
+		},
+	}.write(t, cityPath)
+	testMMDB{
+		dbType:     "geo-whois-asn-country",
+		buildEpoch: 1700000000,
+		networks: map[string]map[string]interface{}{
+			"203.0.113.0/24":  {"country_code": "FR"},
+			"198.51.100.0/24": {"country_code": "JP", "city": "Tokyo", "state1": "Tokyo", "timezone": "Asia/Tokyo"},
+		},
+	}.write(t, countryPath)
+
+	db := NewLocalDB([]string{asnPath, cityPath, countryPath}, 0)
+	defer db.Close()
+
+	info, err := db.Lookup("203.0.113.10", nil, nil)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if info.ASN != 3320 || info.Country != "Germany" || info.CountryCode != "DE" ||
+		info.City != "Berlin" || info.Region != "Land Berlin" || info.Timezone != "Europe/Berlin" {
+		t.Errorf("unexpected result: %+v", info)
+	}
+	if info.Latitude != 52.52 || info.Longitude != 13.405 {
+		t.Errorf("location = %v,%v, want 52.52,13.405", info.Latitude, info.Longitude)
+	}
+	if got := info.Provenance["city"]; got != SourceMMDB {
+		t.Errorf("provenance[city] = %q, want %q", got, SourceMMDB)
+	}
+
+	// Only the flat sapics database covers this network
+	info, err = db.Lookup("198.51.100.7", nil, nil)
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if info.CountryCode != "JP" || info.City != "Tokyo" || info.Region != "Tokyo" || info.Timezone != "Asia/Tokyo" {
+		t.Errorf("unexpected flat-layout result: %+v", info)
+	}
+
+	// IPv4-only databases are skipped for IPv6 addresses
+	if _, err := db.Lookup("2001:db8::1", nil, nil); err != nil {
+		t.Errorf("IPv6 lookup against IPv4 databases: %v", err)
+	}
+}
+
+func TestLookupCrossChecksProviderASNOnLocalPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	testMMDB{
+		dbType:     "GeoLite2-ASN",
+		buildEpoch: 1700000000,
+		networks: map[string]map[string]interface{}{
+			"93.184.113.0/24": {
+				"autonomous_system_number":       64500,
+				"autonomous_system_organization": "Example Networks",
+			},
+		},
+	}.write(t, path)
+
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			return &model.IPInfo{IP: ip, ASN: 16509, ASNOrg: "Amazon.com", Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.localDB = NewLocalDB([]string{path}, 0)
+	defer svc.localDB.Close()
+
+	info, err := svc.Lookup(context.Background(), "93.184.113.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDatacenter || info.Provenance["is_datacenter"] != SourceASNList {
+		t.Fatalf("datacenter=%v provenance=%v", info.IsDatacenter, info.Provenance)
+	}
+}
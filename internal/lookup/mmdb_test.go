@@ -0,0 +1,179 @@
+package lookup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testMMDB describes a small IPv4 MMDB file for tests.
+type testMMDB struct {
+	dbType     string
+	buildEpoch uint64
+	networks   map[string]map[string]interface{} // CIDR → record
+}
+
+// write encodes the database and atomically replaces path with it,
+// the same way scripts/download-db.sh does.
+func (m testMMDB) write(t *testing.T, path string) {
+	t.Helper()
+
+	type node struct {
+		child [2]*node
+		data  [2]int // data section offset + 1, 0 = empty
+	}
+	root := &node{}
+	var data bytes.Buffer
+
+	cidrs := make([]string, 0, len(m.networks))
+	for c := range m.networks {
+		cidrs = append(cidrs, c)
+	}
+	sort.Strings(cidrs)
+	for _, c := range cidrs {
+		_, ipnet, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := ipnet.Mask.Size()
+		ip := binary.BigEndian.Uint32(ipnet.IP.To4())
+		offset := data.Len()
+		encodeMMDBValue(&data, m.networks[c])
+
+		n := root
+		for i := 0; i < ones-1; i++ {
+			bit := (ip >> (31 - i)) & 1
+			if n.child[bit] == nil {
+				n.child[bit] = &node{}
+			}
+			n = n.child[bit]
+		}
+		n.data[(ip>>(32-ones))&1] = offset + 1
+	}
+
+	// Number nodes breadth-first.
+	nodes := []*node{root}
+	index := map[*node]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, c := range nodes[i].child {
+			if c != nil {
+				index[c] = len(nodes)
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	nodeCount := len(nodes)
+
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for b := 0; b < 2; b++ {
+			rec := nodeCount // empty
+			if n.child[b] != nil {
+				rec = index[n.child[b]]
+			} else if n.data[b] != 0 {
+				rec = nodeCount + 16 + n.data[b] - 1
+			}
+			out.Write([]byte{byte(rec >> 16), byte(rec >> 8), byte(rec)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeMMDBValue(&out, map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               m.dbType,
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 m.buildEpoch,
+		"description":                 map[string]interface{}{"en": "test"},
+	})
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// encodeMMDBValue writes v in the MaxMind DB data section format.
+func encodeMMDBValue(w *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case string:
+		writeMMDBControl(w, 2, len(x))
+		w.WriteString(x)
+	case float64:
+		writeMMDBControl(w, 3, 8)
+		binary.Write(w, binary.BigEndian, math.Float64bits(x))
+	case uint16:
+		writeMMDBUint(w, 5, uint64(x))
+	case uint32:
+		writeMMDBUint(w, 6, uint64(x))
+	case int:
+		writeMMDBUint(w, 6, uint64(x))
+	case uint64:
+		writeMMDBUint(w, 9, x)
+	case map[string]interface{}:
+		writeMMDBControl(w, 7, len(x))
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDBValue(w, k)
+			encodeMMDBValue(w, x[k])
+		}
+	case []interface{}:
+		writeMMDBControl(w, 11, len(x))
+		for _, e := range x {
+			encodeMMDBValue(w, e)
+		}
+	default:
+		panic("unsupported MMDB test value")
+	}
+}
+
+func writeMMDBUint(w *bytes.Buffer, typ int, n uint64) {
+	var buf []byte
+	for n > 0 {
+		buf = append([]byte{byte(n)}, buf...)
+		n >>= 8
+	}
+	writeMMDBControl(w, typ, len(buf))
+	w.Write(buf)
+}
+
+func writeMMDBControl(w *bytes.Buffer, typ, size int) {
+	extended := typ > 7
+	ctrl := byte(typ << 5)
+	if extended {
+		ctrl = 0
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 29+256:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	default:
+		ctrl |= 30
+		s := size - 285
+		extra = []byte{byte(s >> 8), byte(s)}
+	}
+	w.WriteByte(ctrl)
+	if extended {
+		w.WriteByte(byte(typ - 7))
+	}
+	w.Write(extra)
+}
@@ -0,0 +1,52 @@
+package lookup
+
+import (
+	"log"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/cache"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// negativeCacheMaxEntries bounds the failures remembered at once, so that a
+// scan of unresolvable addresses during an outage cannot grow it unbounded.
+const negativeCacheMaxEntries = 100000
+
+// newNegativeCache returns the cache of failed lookups, nil if ttl is 0.
+// It is separate from the result cache: entries expire much sooner, and the
+// cache keeps them in expiry order only with a single TTL.
+func newNegativeCache(ttl time.Duration) *cache.Cache {
+	if ttl <= 0 {
+		return nil
+	}
+	return cache.New(ttl, negativeCacheMaxEntries, 0)
+}
+
+// negativeGet returns the remembered failed result for ip.
+func (s *Service) negativeGet(ip string) (*model.IPInfo, bool) {
+	if s.negative == nil {
+		return nil, false
+	}
+	return s.negative.Get(ip)
+}
+
+// negativeSet remembers that no provider answered for ip, whether they were
+// unavailable or rejected the address, so that repeated lookups don't query
+// them all again until the entry expires.
+func (s *Service) negativeSet(ip string, info *model.IPInfo) {
+	if s.negative != nil {
+		s.negative.Set(ip, info)
+	}
+}
+
+// invalidate drops the in-memory results for which fn returns true, e.g.
+// those an override change applies to.
+func (s *Service) invalidate(fn func(key string, info *model.IPInfo) bool) {
+	n := s.cache.RemoveFunc(fn)
+	if s.negative != nil {
+		n += s.negative.RemoveFunc(fn)
+	}
+	if n > 0 {
+		log.Printf("[lookup] Dropped %d cached results", n)
+	}
+}
@@ -0,0 +1,89 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestLookupCachesFailures(t *testing.T) {
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			return nil, &httpStatusError{Code: 400, Body: "invalid IP address"}
+		}}
+	svc := newTestService(t, p)
+	svc.negative = newNegativeCache(50 * time.Millisecond)
+	t.Cleanup(svc.negative.Stop)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		info, err := svc.Lookup(ctx, "93.184.100.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Source != "none" {
+			t.Fatalf("source = %q", info.Source)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("provider queried %d times, want 1", n)
+	}
+	if st := svc.Stats(ctx); st.NegativeCacheSize != 1 || st.NegativeCacheHits != 2 || st.CacheSize != 0 {
+		t.Fatalf("negative cache: size=%d hits=%d, result cache size=%d", st.NegativeCacheSize, st.NegativeCacheHits, st.CacheSize)
+	}
+
+	// Retried once the entry expired
+	time.Sleep(60 * time.Millisecond)
+	if _, err := svc.Lookup(ctx, "93.184.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("provider queried %d times after expiry, want 2", n)
+	}
+
+	// An override applies at once
+	if _, err := svc.PutOverride(ctx, model.Override{CIDR: "93.184.100.0/24", Category: OverrideDatacenter}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := svc.Lookup(ctx, "93.184.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Source != SourceOverride || !info.IsDatacenter {
+		t.Fatalf("after override: source=%q datacenter=%v", info.Source, info.IsDatacenter)
+	}
+}
+
+func TestLookupDoesNotCacheCanceledFailures(t *testing.T) {
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			return &model.IPInfo{IP: ip, ASN: 64500, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.negative = newNegativeCache(time.Hour)
+	t.Cleanup(svc.negative.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := svc.Lookup(ctx, "93.184.100.1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if svc.negative.Size() != 0 {
+		t.Fatal("canceled lookup remembered as failed")
+	}
+	info, err := svc.Lookup(context.Background(), "93.184.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Source != "api" || calls.Load() != 1 {
+		t.Fatalf("source = %q, provider queried %d times", info.Source, calls.Load())
+	}
+}
@@ -0,0 +1,178 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// SourceOrgName is the provenance of flags derived from the ASN organization name.
+const SourceOrgName = "org-name"
+
+// OrgNameRule scores ASN organization names. Pattern is a case-insensitive
+// regular expression; positive weights point to hosting, negative weights to
+// end-user networks.
+type OrgNameRule struct {
+	Pattern string
+	Weight  float64
+}
+
+// OrgNameRules are the built-in rules. The weights of all matching rules are
+// summed and mapped to a hosting likelihood with the logistic function, so a
+// name without matches scores 0.5 and "China Mobile Cloud" stays well below
+// it because the carrier keyword outweighs "cloud".
+var OrgNameRules = []OrgNameRule{
+	{`hosting`, 3},
+	{`\bvps\b`, 3},
+	{`data ?cent(er|re)s?\b`, 3},
+	{`\bcolo(cation)?\b`, 2.5},
+	{`\bservers?\b`, 2},
+	{`\bdedicated\b`, 2},
+	{`\bcloud\b`, 1.5},
+	{`\bcompute\b`, 1.5},
+	{`\bvirtual\b`, 1},
+
+	{`\bmobile?\b|wireless|cellular`, -4},
+	{`tele(com|kom|communications?)|telefonica`, -3},
+	{`broadband`, -3},
+	{`\b(dsl|fib(er|re)|ftth)\b`, -2},
+	{`\bcable\b`, -2},
+}
+
+type orgRule struct {
+	re     *regexp.Regexp
+	weight float64
+}
+
+// orgScorer maps organization names to a hosting likelihood. Names scoring
+// at least threshold are treated as hosting, names scoring at most
+// 1-threshold as end-user networks; anything in between is left to the
+// providers.
+type orgScorer struct {
+	rules     []orgRule
+	threshold float64
+}
+
+// newOrgScorer compiles rules. Later rules with the same pattern replace
+// earlier ones, so a rules file can re-weight a built-in rule.
+func newOrgScorer(rules []OrgNameRule, threshold float64) (*orgScorer, error) {
+	s := &orgScorer{threshold: threshold}
+	index := make(map[string]int, len(rules))
+	for _, r := range rules {
+		re, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("org name rule %q: %w", r.Pattern, err)
+		}
+		if i, ok := index[r.Pattern]; ok {
+			s.rules[i].weight = r.Weight
+			continue
+		}
+		index[r.Pattern] = len(s.rules)
+		s.rules = append(s.rules, orgRule{re: re, weight: r.Weight})
+	}
+	return s, nil
+}
+
+// likelihood returns the hosting likelihood of org in (0, 1).
+func (s *orgScorer) likelihood(org string) float64 {
+	var score float64
+	for _, r := range s.rules {
+		if r.re.MatchString(org) {
+			score += r.weight
+		}
+	}
+	return 1 / (1 + math.Exp(-score))
+}
+
+// loadOrgNameRules reads a rules file with one "<weight> <regexp>" per line
+// and appends its rules to the built-in ones.
+func loadOrgNameRules(path string) ([]OrgNameRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := append([]OrgNameRule(nil), OrgNameRules...)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		weight, pattern, ok := strings.Cut(text, " ")
+		w, err := strconv.ParseFloat(weight, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("%s line %d: want \"<weight> <regexp>\"", path, line)
+		}
+		rules = append(rules, OrgNameRule{Pattern: strings.TrimSpace(pattern), Weight: w})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// applyOrgName classifies an ASN the ASN lists do not know from its
+// organization name. A hosting name marks the IP as datacenter; an end-user
+// name clears a datacenter flag reported by a provider, generalizing the
+// residential ASN list to carriers that are not listed. A nil scorer does
+// nothing.
+func applyOrgName(info *model.IPInfo, s *orgScorer) {
+	if s == nil || info.ASNOrg == "" {
+		return
+	}
+	if _, known := LookupASN(info.ASN); known {
+		return
+	}
+	p := s.likelihood(info.ASNOrg)
+	switch {
+	case p >= s.threshold:
+		info.IsDatacenter = true
+		setProvenance(info, SourceOrgName, "is_datacenter")
+		setConfidence(info, "is_datacenter", math.Round(p*100)/100)
+		if info.UsageType == "" {
+			info.UsageType = string(UsageHosting)
+			setProvenance(info, SourceOrgName, "usage_type")
+		}
+	case p <= 1-s.threshold:
+		info.IsDatacenter = false
+		setProvenance(info, SourceOrgName, "is_datacenter")
+		setConfidence(info, "is_datacenter", math.Round((1-p)*100)/100)
+	}
+}
+
+// loadOrgScorer builds the scorer from the rules file and threshold of the
+// configuration. It returns nil, disabling the scorer, for threshold 1 (the
+// default: a hosting answer from the name alone skips the providers' proxy
+// and VPN detection) and when the configuration is invalid.
+func loadOrgScorer(path string, threshold float64) *orgScorer {
+	if threshold <= 0.5 || threshold > 1 {
+		log.Printf("[org-name] WARNING: ORG_HOSTING_THRESHOLD %.2f outside (0.5, 1], scorer disabled", threshold)
+		return nil
+	}
+	if threshold == 1 {
+		return nil
+	}
+	rules := OrgNameRules
+	if path != "" {
+		var err error
+		if rules, err = loadOrgNameRules(path); err != nil {
+			log.Printf("[org-name] WARNING: Failed to load rules, scorer disabled: %v", err)
+			return nil
+		}
+	}
+	s, err := newOrgScorer(rules, threshold)
+	if err != nil {
+		log.Printf("[org-name] WARNING: %v, scorer disabled", err)
+		return nil
+	}
+	log.Printf("[org-name] %d rules, hosting threshold %.2f", len(s.rules), s.threshold)
+	return s
+}
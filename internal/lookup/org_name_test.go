@@ -0,0 +1,106 @@
+package lookup
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestOrgNameLikelihood(t *testing.T) {
+	s, err := newOrgScorer(OrgNameRules, 0.9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for org, want := range map[string]string{
+		"Example Web Hosting Ltd":     "hosting",
+		"EXAMPLE VPS SERVICES":        "hosting",
+		"Example Data Centre AB":      "hosting",
+		"Example Dedicated Servers":   "hosting",
+		"China Mobile Cloud":          "end-user",
+		"Example Telecom":             "end-user",
+		"Example Broadband Cable Inc": "end-user",
+		"Example Networks GmbH":       "unknown",
+		"Example Cloud":               "unknown",
+		"Example Telecom Hosting":     "unknown",
+	} {
+		p := s.likelihood(org)
+		got := "unknown"
+		switch {
+		case p >= s.threshold:
+			got = "hosting"
+		case p <= 1-s.threshold:
+			got = "end-user"
+		}
+		if got != want {
+			t.Errorf("%q: likelihood %.3f → %s, want %s", org, p, got, want)
+		}
+	}
+}
+
+func TestOrgNameRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "org-rules.txt")
+	writeFile(t, path, "# extra rules\n4 \\bnetcup\\b\n0 \\bcloud\\b\n")
+
+	s := loadOrgScorer(path, 0.95)
+	if s == nil {
+		t.Fatal("scorer not loaded")
+	}
+	if s.threshold != 0.95 || len(s.rules) != len(OrgNameRules)+1 {
+		t.Fatalf("threshold %.2f, %d rules", s.threshold, len(s.rules))
+	}
+	if p := s.likelihood("netcup GmbH"); p < 0.95 {
+		t.Errorf("netcup likelihood %.3f", p)
+	}
+	// Re-weighted built-in rule
+	if p := s.likelihood("Example Cloud"); p != 0.5 {
+		t.Errorf("cloud likelihood %.3f, want 0.5", p)
+	}
+
+	writeFile(t, path, "heavy \\bhosting\\b\n")
+	if _, err := loadOrgNameRules(path); err == nil {
+		t.Fatal("expected error for a missing weight")
+	}
+}
+
+func TestLookupAppliesOrgName(t *testing.T) {
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			return &model.IPInfo{IP: ip, ASN: 64500, ASNOrg: "Example Mobile Cloud", IsDatacenter: true, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.orgs = loadOrgScorer("", 0.9)
+
+	// A provider's datacenter flag on a carrier is cleared
+	info, err := svc.Lookup(context.Background(), "93.184.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDatacenter || info.Provenance["is_datacenter"] != SourceOrgName {
+		t.Fatalf("datacenter=%v provenance=%v", info.IsDatacenter, info.Provenance)
+	}
+
+	// Unlisted hosting ASNs are answered from the MMDB
+	dir := t.TempDir()
+	mmdb := filepath.Join(dir, "asn.mmdb")
+	asnDB(1700000000, 64501, "Example VPS Hosting").write(t, mmdb)
+	db := NewLocalDB([]string{mmdb}, 0)
+	defer db.Close()
+
+	local, err := db.Lookup("203.0.113.7", nil, svc.orgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !local.IsDatacenter || local.UsageType != "hosting" || local.Confidence["is_datacenter"] < 0.9 {
+		t.Fatalf("datacenter=%v usage=%q confidence=%v", local.IsDatacenter, local.UsageType, local.Confidence)
+	}
+
+	// Threshold 1 disables the scorer
+	if s := loadOrgScorer("", 1); s != nil {
+		t.Fatalf("threshold 1: scorer %+v", s)
+	}
+	if local, err = db.Lookup("203.0.113.7", nil, nil); err != nil || local.IsDatacenter {
+		t.Fatalf("disabled scorer: datacenter=%v err=%v", local.IsDatacenter, err)
+	}
+}
@@ -0,0 +1,287 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/iptrie"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// Override categories.
+const (
+	OverrideDatacenter  = "datacenter"
+	OverrideResidential = "residential"
+	OverrideVPN         = "vpn"
+	OverrideProxy       = "proxy"
+	OverrideAllow       = "allow" // clears every security flag
+)
+
+// SourceOverride is the provenance and Source of values set by an override.
+const SourceOverride = "override"
+
+// ErrInvalidOverride is returned for overrides that fail validation.
+var ErrInvalidOverride = errors.New("invalid override")
+
+// ErrOverrideNotFound is returned when deleting an override that does not exist.
+var ErrOverrideNotFound = errors.New("override not found")
+
+// overrideSet holds the active overrides. CIDR overrides are matched by
+// longest prefix and take precedence over ASN overrides.
+type overrideSet struct {
+	mu    sync.RWMutex
+	asns  map[int]model.Override
+	cidrs *iptrie.Trie[model.Override]
+}
+
+func newOverrideSet() *overrideSet {
+	return &overrideSet{
+		asns:  make(map[int]model.Override),
+		cidrs: iptrie.New[model.Override](),
+	}
+}
+
+// match returns the override that applies to ip or asn.
+func (s *overrideSet) match(ip string, asn int) (model.Override, bool) {
+	if s == nil {
+		return model.Override{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		if _, o, ok := s.cidrs.Lookup(addr); ok {
+			return o, true
+		}
+	}
+	if asn != 0 {
+		o, ok := s.asns[asn]
+		return o, ok
+	}
+	return model.Override{}, false
+}
+
+func (s *overrideSet) put(o model.Override) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o.CIDR != "" {
+		s.cidrs.Insert(netip.MustParsePrefix(o.CIDR), o)
+	} else {
+		s.asns[o.ASN] = o
+	}
+}
+
+// splits reports whether a CIDR override more specific than p lies inside
+// it, so that addresses of p may be classified differently.
+func (s *overrideSet) splits(p netip.Prefix) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	split := false
+	s.cidrs.WalkWithin(p, func(q netip.Prefix, _ model.Override) bool {
+		split = q.Bits() > p.Bits()
+		return !split
+	})
+	return split
+}
+
+// remove deletes the override with the same target as o.
+func (s *overrideSet) remove(o model.Override) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o.CIDR != "" {
+		return s.cidrs.Delete(netip.MustParsePrefix(o.CIDR))
+	}
+	_, ok := s.asns[o.ASN]
+	delete(s.asns, o.ASN)
+	return ok
+}
+
+// list returns ASN overrides sorted by ASN, then CIDR overrides in address
+// order, IPv4 first.
+func (s *overrideSet) list() []model.Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	asns := make([]model.Override, 0, len(s.asns))
+	for _, o := range s.asns {
+		asns = append(asns, o)
+	}
+	sort.Slice(asns, func(i, j int) bool { return asns[i].ASN < asns[j].ASN })
+
+	s.cidrs.Walk(func(_ netip.Prefix, o model.Override) bool {
+		asns = append(asns, o)
+		return true
+	})
+	return asns
+}
+
+// normalizeOverride validates o and canonicalizes its CIDR, e.g.
+// "203.0.113.7/24" → "203.0.113.0/24" and a bare IP → a host prefix.
+func normalizeOverride(o model.Override) (model.Override, error) {
+	if (o.ASN != 0) == (o.CIDR != "") {
+		return o, fmt.Errorf("%w: set exactly one of asn and cidr", ErrInvalidOverride)
+	}
+	if o.ASN < 0 || o.ASN > maxASN {
+		return o, fmt.Errorf("%w: ASN %d out of range", ErrInvalidOverride, o.ASN)
+	}
+	if o.CIDR != "" {
+		p, err := parsePrefix(o.CIDR)
+		if err != nil {
+			return o, fmt.Errorf("%w: %v", ErrInvalidOverride, err)
+		}
+		o.CIDR = p.String()
+	}
+	return o, nil
+}
+
+// parsePrefix parses a CIDR or a bare IP address (as a host prefix) and
+// returns it masked, with IPv4-mapped IPv6 addresses unmapped.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		if p.Addr().Is4In6() {
+			if p.Bits() < 96 {
+				return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+			}
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// applyOverride sets the security flags dictated by o.
+func applyOverride(info *model.IPInfo, o model.Override) {
+	var flags []string
+	switch o.Category {
+	case OverrideDatacenter:
+		info.IsDatacenter = true
+		flags = []string{"is_datacenter"}
+	case OverrideResidential:
+		info.IsDatacenter = false
+		flags = []string{"is_datacenter"}
+	case OverrideVPN:
+		info.IsVPN = true
+		flags = []string{"is_vpn"}
+	case OverrideProxy:
+		info.IsProxy = true
+		flags = []string{"is_proxy"}
+	case OverrideAllow:
+		info.IsDatacenter, info.IsProxy, info.IsVPN, info.IsTor = false, false, false, false
+		flags = []string{"is_datacenter", "is_proxy", "is_vpn", "is_tor"}
+	}
+	setProvenance(info, SourceOverride, flags...)
+	for _, f := range flags {
+		setConfidence(info, f, 1)
+	}
+}
+
+// loadOverrides reads the persisted overrides from the store.
+func (s *Service) loadOverrides(ctx context.Context) {
+	list, err := s.store.ListOverrides(ctx)
+	if err != nil {
+		log.Printf("[override] Failed to load overrides: %v", err)
+		return
+	}
+	for _, o := range list {
+		if o, err := normalizeOverride(o); err == nil {
+			s.overrides.put(o)
+		}
+	}
+	if len(list) > 0 {
+		log.Printf("[override] Loaded %d classification overrides", len(list))
+	}
+}
+
+// Overrides returns the active classification overrides.
+func (s *Service) Overrides() []model.Override {
+	return s.overrides.list()
+}
+
+// OverridesPersisted reports whether overrides survive a restart, i.e.
+// whether a persistent store is configured.
+func (s *Service) OverridesPersisted() bool {
+	return s.store != nil
+}
+
+// PutOverride validates, persists and activates an override, replacing any
+// override for the same ASN or CIDR. Cached results for its ASN or CIDR are
+// dropped so that the override applies to their next lookup.
+func (s *Service) PutOverride(ctx context.Context, o model.Override) (model.Override, error) {
+	o, err := normalizeOverride(o)
+	if err != nil {
+		return o, err
+	}
+	switch o.Category {
+	case OverrideDatacenter, OverrideResidential, OverrideVPN, OverrideProxy, OverrideAllow:
+	default:
+		return o, fmt.Errorf("%w: unknown category %q", ErrInvalidOverride, o.Category)
+	}
+	o.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	if s.store != nil {
+		if err := s.store.PutOverride(ctx, o); err != nil {
+			return o, fmt.Errorf("persist override: %w", err)
+		}
+	}
+	s.overrides.put(o)
+	s.invalidate(overrideAffects(o))
+	log.Printf("[override] Set %s → %s", overrideTarget(o), o.Category)
+	return o, nil
+}
+
+// DeleteOverride removes the override for o's ASN or CIDR.
+func (s *Service) DeleteOverride(ctx context.Context, o model.Override) error {
+	o, err := normalizeOverride(o)
+	if err != nil {
+		return err
+	}
+	if s.store != nil {
+		if err := s.store.DeleteOverride(ctx, o); err != nil {
+			return fmt.Errorf("delete override: %w", err)
+		}
+	}
+	if !s.overrides.remove(o) {
+		return ErrOverrideNotFound
+	}
+	s.invalidate(overrideAffects(o))
+	log.Printf("[override] Removed %s", overrideTarget(o))
+	return nil
+}
+
+// overrideAffects returns a cache filter matching the entries o may change:
+// those of its ASN, or the addresses and shared networks overlapping its CIDR.
+func overrideAffects(o model.Override) func(key string, info *model.IPInfo) bool {
+	if o.CIDR == "" {
+		return func(_ string, info *model.IPInfo) bool { return info.ASN == o.ASN }
+	}
+	p := netip.MustParsePrefix(o.CIDR)
+	return func(key string, _ *model.IPInfo) bool {
+		if q, err := netip.ParsePrefix(key); err == nil {
+			return p.Overlaps(q)
+		}
+		addr, err := netip.ParseAddr(key)
+		return err == nil && p.Contains(addr.Unmap())
+	}
+}
+
+func overrideTarget(o model.Override) string {
+	if o.CIDR != "" {
+		return o.CIDR
+	}
+	return fmt.Sprintf("AS%d", o.ASN)
+}
@@ -0,0 +1,155 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+	"github.com/akl7777777/ip-intel/internal/store"
+)
+
+func TestOverrideMatchPrefersLongestCIDR(t *testing.T) {
+	set := newOverrideSet()
+	for _, o := range []model.Override{
+		{CIDR: "203.0.0.0/16", Category: OverrideDatacenter},
+		{CIDR: "203.0.113.0/24", Category: OverrideVPN},
+		{ASN: 64496, Category: OverrideProxy},
+	} {
+		o, err := normalizeOverride(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set.put(o)
+	}
+
+	cases := []struct {
+		ip   string
+		asn  int
+		want string
+	}{
+		{"203.0.113.9", 64496, OverrideVPN},    // CIDR beats ASN, /24 beats /16
+		{"::ffff:203.0.113.9", 0, OverrideVPN}, // mapped IPv4
+		{"203.0.5.1", 0, OverrideDatacenter},   // only the /16
+		{"198.51.100.1", 64496, OverrideProxy}, // ASN only
+		{"198.51.100.1", 64497, ""},            // nothing
+	}
+	for _, tc := range cases {
+		o, ok := set.match(tc.ip, tc.asn)
+		if got := o.Category; ok != (tc.want != "") || got != tc.want {
+			t.Errorf("match(%s, %d) = %q, %v, want %q", tc.ip, tc.asn, got, ok, tc.want)
+		}
+	}
+}
+
+func TestNormalizeOverride(t *testing.T) {
+	o, err := normalizeOverride(model.Override{CIDR: "203.0.113.77/24"})
+	if err != nil || o.CIDR != "203.0.113.0/24" {
+		t.Errorf("CIDR = %q, %v, want masked 203.0.113.0/24", o.CIDR, err)
+	}
+	o, err = normalizeOverride(model.Override{CIDR: "2001:db8::1"})
+	if err != nil || o.CIDR != "2001:db8::1/128" {
+		t.Errorf("bare IPv6 = %q, %v, want host prefix", o.CIDR, err)
+	}
+	for _, bad := range []model.Override{{}, {ASN: 1, CIDR: "10.0.0.0/8"}, {CIDR: "nope"}, {ASN: -1}} {
+		if _, err := normalizeOverride(bad); !errors.Is(err, ErrInvalidOverride) {
+			t.Errorf("normalizeOverride(%+v) err = %v, want ErrInvalidOverride", bad, err)
+		}
+	}
+}
+
+func TestOverrideAppliesBeforeProviders(t *testing.T) {
+	p := &FuncProvider{ProviderName: "api", Detects: DetectsVPN, Limits: Quota{PerMinute: 10},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			return &model.IPInfo{IP: ip, ASN: 64500, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	ctx := context.Background()
+
+	// Warm the cache; adding the override must invalidate it
+	if info, _ := svc.Lookup(ctx, "93.184.113.10"); info.IsVPN {
+		t.Fatal("unexpected VPN before override")
+	}
+	if _, err := svc.PutOverride(ctx, model.Override{CIDR: "93.184.113.0/24", Category: OverrideVPN}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := svc.Lookup(ctx, "93.184.113.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsVPN || info.Source != SourceOverride || info.Provenance["is_vpn"] != SourceOverride {
+		t.Errorf("CIDR override not applied: %+v", info)
+	}
+	if n := svc.providers[0].UsedLastMinute(); n != 1 {
+		t.Errorf("provider called %d times, want 1 (warm-up only)", n)
+	}
+
+	// Without a local DB the ASN is known only after the provider answered
+	if _, err := svc.PutOverride(ctx, model.Override{ASN: 64500, Category: OverrideDatacenter}); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = svc.Lookup(ctx, "93.184.100.1")
+	if !info.IsDatacenter || info.Provenance["is_datacenter"] != SourceOverride {
+		t.Errorf("ASN override not applied after provider: %+v", info)
+	}
+
+	if err := svc.DeleteOverride(ctx, model.Override{CIDR: "93.184.113.0/24"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteOverride(ctx, model.Override{CIDR: "93.184.113.0/24"}); !errors.Is(err, ErrOverrideNotFound) {
+		t.Errorf("second delete err = %v, want ErrOverrideNotFound", err)
+	}
+	if _, err := svc.PutOverride(ctx, model.Override{ASN: 1, Category: "hosting"}); !errors.Is(err, ErrInvalidOverride) {
+		t.Errorf("unknown category err = %v, want ErrInvalidOverride", err)
+	}
+
+	// Entries outside the override's CIDR or ASN stay cached
+	svc.cache.Set("93.184.200.1", &model.IPInfo{IP: "93.184.200.1", ASN: 64501})
+	if _, err := svc.PutOverride(ctx, model.Override{CIDR: "93.184.201.0/24", Category: OverrideProxy}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.PutOverride(ctx, model.Override{ASN: 64502, Category: OverrideProxy}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svc.cache.Peek("93.184.200.1"); !ok {
+		t.Error("unrelated entry dropped by override change")
+	}
+	if _, err := svc.PutOverride(ctx, model.Override{ASN: 64501, Category: OverrideProxy}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := svc.cache.Peek("93.184.200.1"); ok {
+		t.Error("entry of the override's ASN still cached")
+	}
+}
+
+func TestOverridesPersistAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	ctx := context.Background()
+
+	st, err := store.NewSQLite(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newTestService(t)
+	svc.store = st
+	if _, err := svc.PutOverride(ctx, model.Override{CIDR: "198.51.100.0/24", Category: OverrideAllow, Note: "office"}); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	st, err = store.NewSQLite(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	restarted := newTestService(t)
+	restarted.store = st
+	restarted.loadOverrides(ctx)
+
+	list := restarted.Overrides()
+	if len(list) != 1 || list[0].CIDR != "198.51.100.0/24" || list[0].Category != OverrideAllow || list[0].Note != "office" {
+		t.Fatalf("overrides after restart = %+v", list)
+	}
+}
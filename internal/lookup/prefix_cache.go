@@ -0,0 +1,119 @@
+package lookup
+
+import (
+	"context"
+	"log"
+	"maps"
+	"net/netip"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/cache"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// asnLevelSources are the provenance sources that depend only on the ASN (or
+// an MMDB network), not on the individual address.
+var asnLevelSources = map[string]bool{
+	SourceMMDB:    true,
+	SourceASNList: true,
+	SourceOrgName: true,
+}
+
+// cachePrefix returns the network whose shared cache entry may answer ip,
+// or an invalid prefix if prefix caching is disabled for its family.
+func (s *Service) cachePrefix(ip string) netip.Prefix {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}
+	}
+	bits := s.prefixV6
+	if addr.Is4() {
+		bits = s.prefixV4
+	}
+	if bits == 0 {
+		return netip.Prefix{}
+	}
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// sharedPrefix returns the network info may be cached for. An IPv6 prefix
+// (e.g. a /64) usually belongs to one subscriber, so any result is shared;
+// an IPv4 prefix only shares results decided by ASN-level sources. Tor exits
+// and networks split by a more specific CIDR override are never shared.
+func (s *Service) sharedPrefix(ip string, info *model.IPInfo) (netip.Prefix, bool) {
+	p := s.cachePrefix(ip)
+	if !p.IsValid() || info.IsTor || info.ReservedType != "" {
+		return netip.Prefix{}, false
+	}
+	if p.Addr().Is4() {
+		if info.Source != "local" {
+			return netip.Prefix{}, false
+		}
+		for _, src := range info.Provenance {
+			if !asnLevelSources[src] {
+				return netip.Prefix{}, false
+			}
+		}
+	}
+	if s.overrides.splits(p) {
+		return netip.Prefix{}, false
+	}
+	return p, true
+}
+
+// sharedCopy returns info without per-address fields, for storing under a prefix.
+func sharedCopy(info *model.IPInfo) *model.IPInfo {
+	shared := *info
+	shared.Hostname = ""
+	if _, ok := info.Provenance["hostname"]; ok {
+		shared.Provenance = maps.Clone(info.Provenance)
+		delete(shared.Provenance, "hostname")
+	}
+	return &shared
+}
+
+// cacheGet returns the cached result for ip or its network. A shared entry
+// is not used for listed Tor exits, which may sit among ordinary addresses.
+func (s *Service) cacheGet(ip string) (*model.IPInfo, cache.Hit, bool) {
+	info, hit, ok := s.cache.GetPrefix(ip, s.cachePrefix(ip))
+	if ok && hit.Shared && s.torExits.Contains(ip) {
+		return nil, cache.Hit{}, false
+	}
+	return info, hit, ok
+}
+
+// cacheSet caches info for ip and, if it can be shared, for its network.
+func (s *Service) cacheSet(ip string, info *model.IPInfo) {
+	s.cache.Set(ip, info)
+	if p, ok := s.sharedPrefix(ip, info); ok {
+		s.cache.SetPrefix(p, sharedCopy(info))
+	}
+}
+
+// storeGet reads the persistent cache for ip, then for its network, and
+// returns when the result was stored.
+func (s *Service) storeGet(ctx context.Context, ip string) (*model.IPInfo, time.Time, bool) {
+	if info, storedAt, ok := s.store.Get(ctx, ip); ok {
+		return info, storedAt, true
+	}
+	p := s.cachePrefix(ip)
+	if !p.IsValid() || s.torExits.Contains(ip) {
+		return nil, time.Time{}, false
+	}
+	info, storedAt, ok := s.store.Get(ctx, p.String())
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	info.IP = ip
+	return info, storedAt, true
+}
+
+// validPrefixLen returns bits if it is a usable prefix length, else 0.
+func validPrefixLen(bits, max int, name string) int {
+	if bits < 0 || bits > max {
+		log.Printf("[lookup] WARNING: %s=%d outside 0-%d, prefix caching disabled", name, bits, max)
+		return 0
+	}
+	return bits
+}
@@ -0,0 +1,152 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestLookupSharesIPv6PrefixEntries(t *testing.T) {
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			return &model.IPInfo{IP: ip, ASN: 64500, IsProxy: true, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.prefixV6 = 64
+	svc.resolver = staticResolver{"2a01:db8:1:2::1": "host-1.example.net"}
+
+	if _, err := svc.Lookup(context.Background(), "2a01:db8:1:2::1"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := svc.Lookup(context.Background(), "2a01:db8:1:2:aaaa::7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IP != "2a01:db8:1:2:aaaa::7" || !info.IsProxy || !info.Cached || info.Hostname != "" {
+		t.Fatalf("neighbour: ip=%q proxy=%v cached=%v hostname=%q", info.IP, info.IsProxy, info.Cached, info.Hostname)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("provider queried %d times, want 1", n)
+	}
+	if st := svc.cache.Stats(); st.PrefixHits != 1 {
+		t.Fatalf("prefix hits = %d", st.PrefixHits)
+	}
+
+	// Another /64 is looked up again
+	if _, err := svc.Lookup(context.Background(), "2a01:db8:1:3::1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("provider queried %d times, want 2", n)
+	}
+}
+
+func TestLookupSharesIPv4PrefixOnlyForASNLevelResults(t *testing.T) {
+	dir := t.TempDir()
+	mmdb := filepath.Join(dir, "asn.mmdb")
+	// A routed network: Lookup answers documentation ranges without the MMDB
+	testMMDB{
+		dbType:     "GeoLite2-ASN",
+		buildEpoch: 1700000000,
+		networks: map[string]map[string]interface{}{
+			"93.184.113.0/24": {
+				"autonomous_system_number":       16509,
+				"autonomous_system_organization": "AMAZON-02",
+			},
+		},
+	}.write(t, mmdb)
+
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			return &model.IPInfo{IP: ip, ASN: 64500, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.prefixV4 = 24
+	svc.localDB = NewLocalDB([]string{mmdb}, 0)
+	t.Cleanup(svc.localDB.Close)
+
+	// Datacenter from the ASN list: shared with the /24
+	if _, err := svc.Lookup(context.Background(), "93.184.113.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, hit, ok := svc.cache.GetPrefix("93.184.113.2", svc.cachePrefix("93.184.113.2")); !ok || !hit.Shared {
+		t.Fatal("ASN-level result not shared with the /24")
+	}
+
+	// Provider results may be per address: not shared
+	if _, err := svc.Lookup(context.Background(), "93.184.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Lookup(context.Background(), "93.184.100.2"); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("provider queried %d times, want 2", n)
+	}
+}
+
+func TestPrefixSharingRespectsOverridesAndTor(t *testing.T) {
+	svc := newTestService(t)
+	svc.prefixV4 = 24
+	svc.overrides.put(model.Override{CIDR: "93.184.113.128/25", Category: OverrideResidential})
+	info := &model.IPInfo{IP: "93.184.113.1", ASN: 16509, Source: "local", Provenance: map[string]string{"asn": SourceMMDB}}
+	if _, ok := svc.sharedPrefix(info.IP, info); ok {
+		t.Fatal("prefix split by a CIDR override was shared")
+	}
+
+	svc.overrides = newOverrideSet()
+	svc.cacheSet(info.IP, info)
+	path := filepath.Join(t.TempDir(), "exits.txt")
+	writeFile(t, path, "93.184.113.9\n")
+	svc.torExits = newTorExitList(path, 0)
+	t.Cleanup(svc.torExits.Close)
+
+	if _, _, ok := svc.cacheGet("93.184.113.8"); !ok {
+		t.Fatal("neighbour not answered from the shared entry")
+	}
+	if _, _, ok := svc.cacheGet("93.184.113.9"); ok {
+		t.Fatal("Tor exit answered from the shared entry")
+	}
+}
+
+func TestLookupDoesNotShareDegradedLocalResult(t *testing.T) {
+	mmdb := filepath.Join(t.TempDir(), "asn.mmdb")
+	testMMDB{
+		dbType:     "GeoLite2-ASN",
+		buildEpoch: 1700000000,
+		networks: map[string]map[string]interface{}{
+			"93.184.113.0/24": {
+				"autonomous_system_number":       64500,
+				"autonomous_system_organization": "Example Networks",
+			},
+		},
+	}.write(t, mmdb)
+
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			return nil, errors.New("unavailable")
+		}}
+	svc := newTestService(t, p)
+	svc.prefixV4 = 24
+	svc.localDB = NewLocalDB([]string{mmdb}, 0)
+	t.Cleanup(svc.localDB.Close)
+
+	info, err := svc.Lookup(context.Background(), "93.184.113.1")
+	if err != nil || info.Source != "local" {
+		t.Fatalf("source=%q err=%v", info.Source, err)
+	}
+	if _, ok := svc.cache.Peek("93.184.113.1"); !ok {
+		t.Fatal("degraded result not cached for its own IP")
+	}
+	if _, hit, ok := svc.cache.GetPrefix("93.184.113.2", svc.cachePrefix("93.184.113.2")); ok && hit.Shared {
+		t.Fatal("degraded result shared with the /24")
+	}
+}
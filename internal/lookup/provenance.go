@@ -0,0 +1,154 @@
+package lookup
+
+import (
+	"strings"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// Provenance sources that are not provider names.
+const (
+	SourceMMDB            = "mmdb"
+	SourceASNList         = "asn-list"
+	SourceConsensus       = "consensus"
+	SourcePersistentCache = "persistent-cache"
+)
+
+// Confidence levels for security flags.
+const (
+	// confidenceASNList is used when a flag is decided by the curated ASN lists.
+	confidenceASNList = 0.95
+	// confidenceProvider is used when a single provider able to detect the flag reported it.
+	confidenceProvider = 0.7
+)
+
+// setProvenance records source as the origin of the given fields.
+func setProvenance(info *model.IPInfo, source string, fields ...string) {
+	if info.Provenance == nil {
+		info.Provenance = make(map[string]string, len(fields))
+	}
+	for _, f := range fields {
+		info.Provenance[f] = source
+	}
+}
+
+// setConfidence records the confidence of a security flag.
+func setConfidence(info *model.IPInfo, flag string, c float64) {
+	if info.Confidence == nil {
+		info.Confidence = make(map[string]float64, 4)
+	}
+	info.Confidence[flag] = c
+}
+
+// annotateProviderResult records provider p as the source of every
+// descriptive field it filled and of every flag it is able to detect.
+func annotateProviderResult(info *model.IPInfo, p Provider) {
+	setProvenance(info, p.Name(), descriptiveFields(info)...)
+	for _, f := range consensusFlags {
+		if p.Capabilities()&f.detect != 0 {
+			setProvenance(info, p.Name(), f.name)
+			setConfidence(info, f.name, confidenceProvider)
+		}
+	}
+}
+
+// descriptiveFields returns the names of the non-empty non-flag fields.
+func descriptiveFields(info *model.IPInfo) []string {
+	var fields []string
+	if info.ASN != 0 {
+		fields = append(fields, "asn")
+	}
+	if info.ASNOrg != "" {
+		fields = append(fields, "asn_org")
+	}
+	if info.ISP != "" {
+		fields = append(fields, "isp")
+	}
+	if info.UsageType != "" {
+		fields = append(fields, "usage_type")
+	}
+	if info.Country != "" {
+		fields = append(fields, "country")
+	}
+	if info.CountryCode != "" {
+		fields = append(fields, "country_code")
+	}
+	if info.City != "" {
+		fields = append(fields, "city")
+	}
+	if info.Region != "" {
+		fields = append(fields, "region")
+	}
+	if info.Latitude != 0 || info.Longitude != 0 {
+		fields = append(fields, "latitude", "longitude")
+	}
+	if info.Timezone != "" {
+		fields = append(fields, "timezone")
+	}
+	return fields
+}
+
+// setUsageType sets UsageType from the ASN list. The curated list wins over
+// a usage type reported by a provider.
+func setUsageType(info *model.IPInfo) {
+	if e, ok := LookupASN(info.ASN); ok {
+		info.UsageType = string(e.Usage)
+		setProvenance(info, SourceASNList, "usage_type")
+	}
+}
+
+// markDatacenterASN sets IsDatacenter because the ASN is on the datacenter list.
+func markDatacenterASN(info *model.IPInfo) {
+	info.IsDatacenter = true
+	setProvenance(info, SourceASNList, "is_datacenter")
+	setConfidence(info, "is_datacenter", confidenceASNList)
+	setUsageType(info)
+}
+
+// markResidentialASN clears IsDatacenter because the ASN is a known residential
+// ISP, overriding stale or misclassified datacenter flags from other sources.
+func markResidentialASN(info *model.IPInfo, org string) {
+	info.IsDatacenter = false
+	info.ISP = org
+	setProvenance(info, SourceASNList, "is_datacenter", "isp")
+	setConfidence(info, "is_datacenter", confidenceASNList)
+	setUsageType(info)
+}
+
+// mergeLocalASN fills ASN fields from the local MMDB result when the API missed them.
+func mergeLocalASN(dst, local *model.IPInfo) {
+	if dst.ASN != 0 {
+		return
+	}
+	dst.ASN = local.ASN
+	dst.ASNOrg = local.ASNOrg
+	for _, f := range []string{"asn", "asn_org"} {
+		if src, ok := local.Provenance[f]; ok {
+			setProvenance(dst, src, f)
+		}
+	}
+}
+
+// mergeLocalGeo fills geolocation fields from the local MMDB result when the
+// API missed them.
+func mergeLocalGeo(dst, local *model.IPInfo) {
+	fillMissing(dst, &model.IPInfo{
+		Country:     local.Country,
+		CountryCode: local.CountryCode,
+		City:        local.City,
+		Region:      local.Region,
+		Latitude:    local.Latitude,
+		Longitude:   local.Longitude,
+		Timezone:    local.Timezone,
+	}, SourceMMDB)
+}
+
+// markFromPersistentCache prefixes every provenance entry so that analysts can
+// tell the value was replayed from the persistent cache.
+func markFromPersistentCache(info *model.IPInfo) {
+	for f, src := range info.Provenance {
+		if !strings.HasPrefix(src, SourcePersistentCache+"/") {
+			info.Provenance[f] = SourcePersistentCache + "/" + src
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package lookup
+
+import (
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestProvenanceExplainsResidentialOverride(t *testing.T) {
+	local := &model.IPInfo{ASN: 4134, ASNOrg: "CHINANET-BACKBONE"}
+	setProvenance(local, SourceMMDB, "asn", "asn_org")
+
+	api := &model.IPInfo{IsDatacenter: true, Country: "China"}
+	annotateProviderResult(api, &FuncProvider{ProviderName: "ip-api", Detects: DetectsDatacenter | DetectsProxy})
+
+	mergeLocalASN(api, local)
+	if org, ok := IsKnownResidentialASN(api.ASN); ok {
+		markResidentialASN(api, org)
+	}
+
+	want := map[string]string{
+		"asn":           SourceMMDB,
+		"asn_org":       SourceMMDB,
+		"country":       "ip-api",
+		"is_proxy":      "ip-api",
+		"is_datacenter": SourceASNList,
+		"isp":           SourceASNList,
+	}
+	for field, src := range want {
+		if got := api.Provenance[field]; got != src {
+			t.Errorf("provenance[%s] = %q, want %q", field, got, src)
+		}
+	}
+	if api.IsDatacenter {
+		t.Error("residential ASN should clear is_datacenter")
+	}
+	if got := api.Confidence["is_datacenter"]; got != confidenceASNList {
+		t.Errorf("confidence[is_datacenter] = %v, want %v", got, confidenceASNList)
+	}
+
+	markFromPersistentCache(api)
+	markFromPersistentCache(api)
+	if got := api.Provenance["country"]; got != "persistent-cache/ip-api" {
+		t.Errorf("persistent cache provenance = %q", got)
+	}
+}
@@ -0,0 +1,278 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/config"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// Provider is an external IP intelligence source.
+// Implementations must be safe for concurrent use. Rate limiting is applied
+// by the lookup chain based on Quota, so Query should not throttle itself.
+type Provider interface {
+	// Name is the unique provider name used in ENABLED_PROVIDERS, logs and stats.
+	Name() string
+	// Query looks up a single IP. It should return promptly once ctx is done.
+	Query(ctx context.Context, ip string) (*model.IPInfo, error)
+	// Capabilities reports which security flags the provider can detect.
+	// A geo-only provider returns 0.
+	Capabilities() Capability
+	// Quota describes the provider's usage limits and key requirements.
+	Quota() Quota
+}
+
+// Capability is a bit set of the security flags a provider reports.
+// Only providers with the matching capability vote on a flag in consensus mode.
+type Capability uint8
+
+const (
+	DetectsDatacenter Capability = 1 << iota
+	DetectsProxy
+	DetectsVPN
+	DetectsTor
+)
+
+var capabilityNames = []struct {
+	c    Capability
+	name string
+}{
+	{DetectsDatacenter, "datacenter"},
+	{DetectsProxy, "proxy"},
+	{DetectsVPN, "vpn"},
+	{DetectsTor, "tor"},
+}
+
+// Names returns the capability names, e.g. ["datacenter", "proxy"].
+func (c Capability) Names() []string {
+	names := []string{}
+	for _, cn := range capabilityNames {
+		if c&cn.c != 0 {
+			names = append(names, cn.name)
+		}
+	}
+	return names
+}
+
+// Quota describes a provider's usage limits.
+// PerDay and PerMonth are counted per UTC calendar day/month and can be
+// overridden with PROVIDER_DAILY_QUOTAS / PROVIDER_MONTHLY_QUOTAS.
+type Quota struct {
+	PerMinute int // max requests per minute, 0 = no per-minute limit (keyed providers)
+	PerDay    int // max requests per day, 0 = unlimited
+	PerMonth  int // max requests per month, 0 = unlimited
+	NeedsKey  bool
+	HasKey    bool
+}
+
+// FuncProvider adapts a plain query function to the Provider interface.
+type FuncProvider struct {
+	ProviderName string
+	QueryFn      func(ctx context.Context, ip string) (*model.IPInfo, error)
+	Detects      Capability
+	Limits       Quota
+}
+
+func (p *FuncProvider) Name() string             { return p.ProviderName }
+func (p *FuncProvider) Capabilities() Capability { return p.Detects }
+func (p *FuncProvider) Quota() Quota             { return p.Limits }
+
+func (p *FuncProvider) Query(ctx context.Context, ip string) (*model.IPInfo, error) {
+	return p.QueryFn(ctx, ip)
+}
+
+// Factory builds a provider from the service config. It is called once when
+// the service starts.
+type Factory func(cfg *config.Config) Provider
+
+type registration struct {
+	name    string
+	factory Factory
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []registration
+)
+
+// Register adds a provider to the default lookup chain. Providers are chained
+// in registration order (built-ins first) unless ENABLED_PROVIDERS reorders
+// them. Register is meant to be called from an init function; registering the
+// same name twice panics.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, r := range registry {
+		if r.name == name {
+			panic(fmt.Sprintf("lookup: provider %q registered twice", name))
+		}
+	}
+	registry = append(registry, registration{name: name, factory: factory})
+}
+
+// registered returns a snapshot of the registry.
+func registered() []registration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return append([]registration(nil), registry...)
+}
+
+// chainProvider is a Provider's entry in the lookup chain. It tracks the calls
+// made in the last minute to enforce Quota().PerMinute, counts calls against
+// the daily/monthly quotas, and trips a circuit breaker when the provider
+// keeps failing.
+type chainProvider struct {
+	Provider
+	breaker circuitBreaker
+
+	mu        sync.Mutex
+	callTimes []int64
+	daily     quotaWindow
+	monthly   quotaWindow
+	usage     usageStore // persists quota usage, may be nil
+}
+
+func newChainProvider(p Provider, cfg *config.Config) *chainProvider {
+	q := p.Quota()
+	perDay, perMonth := q.PerDay, q.PerMonth
+	if n, ok := cfg.ProviderDailyQuotas[p.Name()]; ok {
+		perDay = n
+	}
+	if n, ok := cfg.ProviderMonthlyQuotas[p.Name()]; ok {
+		perMonth = n
+	}
+
+	return &chainProvider{
+		Provider: p,
+		breaker: circuitBreaker{
+			threshold:    cfg.BreakerFailures,
+			baseCooldown: cfg.BreakerCooldown,
+			maxCooldown:  cfg.BreakerMaxCooldown,
+		},
+		daily:   newDailyWindow(perDay),
+		monthly: newMonthlyWindow(perMonth),
+	}
+}
+
+// Available returns true if the provider can accept a request.
+func (p *chainProvider) Available() bool {
+	q := p.Quota()
+	if q.NeedsKey && !q.HasKey {
+		return false
+	}
+	if q.PerMinute <= 0 && !q.HasKey {
+		return false
+	}
+	if !p.breaker.ready() {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.quotaExhaustedLocked() {
+		return false
+	}
+	if q.PerMinute <= 0 {
+		return true
+	}
+	p.pruneCallsLocked()
+	return len(p.callTimes) < q.PerMinute
+}
+
+// Acquire reserves a call slot if the provider is available. The check and
+// the reservation happen under one lock, so concurrent lookups (e.g. from a
+// batch request) cannot push a provider past its per-minute limit.
+// A successful Acquire must be followed by query, which reports the outcome
+// to the circuit breaker.
+func (p *chainProvider) Acquire() bool {
+	q := p.Quota()
+	if q.NeedsKey && !q.HasKey {
+		return false
+	}
+	if q.PerMinute <= 0 && !q.HasKey {
+		return false
+	}
+
+	p.mu.Lock()
+	persist, ok := p.reserveLocked(q.PerMinute)
+	p.mu.Unlock()
+
+	// The quota counters are written synchronously but outside the lock,
+	// so a slow store delays only this lookup
+	if persist != nil {
+		persist()
+	}
+	return ok
+}
+
+// reserveLocked is the locked part of Acquire. It returns the function
+// persisting the call's quota usage, if any.
+// Caller must hold p.mu.
+func (p *chainProvider) reserveLocked(perMinute int) (func(), bool) {
+	if p.quotaExhaustedLocked() {
+		return nil, false
+	}
+	p.pruneCallsLocked()
+	if perMinute > 0 && len(p.callTimes) >= perMinute {
+		return nil, false
+	}
+	if !p.breaker.allow() {
+		return nil, false
+	}
+	p.callTimes = append(p.callTimes, time.Now().Unix())
+	return p.recordUsageLocked(), true
+}
+
+// quotaExhaustedLocked reports whether the daily or monthly quota is used up.
+// Caller must hold p.mu.
+func (p *chainProvider) quotaExhaustedLocked() bool {
+	now := time.Now()
+	p.daily.roll(now)
+	p.monthly.roll(now)
+	return p.daily.exhausted() || p.monthly.exhausted()
+}
+
+// query calls the provider and feeds the outcome to the circuit breaker.
+func (p *chainProvider) query(ctx context.Context, ip string) (*model.IPInfo, error) {
+	info, err := p.Query(ctx, ip)
+	if state, changed := p.breaker.record(classifyCallError(ctx, err)); changed {
+		switch state {
+		case breakerOpen:
+			_, failures, until := p.breaker.snapshot()
+			log.Printf("[breaker] %s opened after %d consecutive failures, retry at %s",
+				p.Name(), failures, until.Format(time.RFC3339))
+		case breakerClosed:
+			log.Printf("[breaker] %s closed, provider recovered", p.Name())
+		}
+	}
+	return info, err
+}
+
+// pruneCallsLocked drops call timestamps older than one minute.
+// Caller must hold p.mu.
+func (p *chainProvider) pruneCallsLocked() {
+	cutoff := time.Now().Unix() - 60
+
+	valid := p.callTimes[:0]
+	for _, t := range p.callTimes {
+		if t > cutoff {
+			valid = append(valid, t)
+		}
+	}
+	p.callTimes = valid
+}
+
+// UsedLastMinute returns how many calls were made in the last minute.
+func (p *chainProvider) UsedLastMinute() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pruneCallsLocked()
+	return len(p.callTimes)
+}
@@ -1,83 +1,43 @@
 package lookup
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/akl7777777/ip-intel/internal/config"
 	"github.com/akl7777777/ip-intel/internal/model"
 )
 
-// Provider is an external IP intelligence API.
-type Provider struct {
-	Name      string
-	QueryFn   func(ip string) (*model.IPInfo, error)
-	RateLimit int // max requests per minute, 0 = needs API key
-	NeedsKey  bool
-	HasKey    bool
+var httpClient = &http.Client{Timeout: 5 * time.Second}
 
-	mu        sync.Mutex
-	callTimes []int64
+// httpStatusError is returned by fetchJSON for non-200 responses.
+type httpStatusError struct {
+	Code int
+	Body string
 }
 
-// Available returns true if the provider can accept a request.
-func (p *Provider) Available() bool {
-	if p.NeedsKey && !p.HasKey {
-		return false
-	}
-	if p.RateLimit <= 0 {
-		return p.HasKey
-	}
-
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	now := time.Now().Unix()
-	cutoff := now - 60
-
-	valid := p.callTimes[:0]
-	for _, t := range p.callTimes {
-		if t > cutoff {
-			valid = append(valid, t)
-		}
-	}
-	p.callTimes = valid
-
-	return len(p.callTimes) < p.RateLimit
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Code, e.Body)
 }
 
-// RecordCall records a call timestamp.
-func (p *Provider) RecordCall() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.callTimes = append(p.callTimes, time.Now().Unix())
+func fetchJSON(ctx context.Context, url string, target interface{}) error {
+	return fetchJSONWithHeaders(ctx, url, nil, target)
 }
 
-// UsedLastMinute returns how many calls were made in the last minute.
-func (p *Provider) UsedLastMinute() int {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	now := time.Now().Unix()
-	cutoff := now - 60
-	count := 0
-	for _, t := range p.callTimes {
-		if t > cutoff {
-			count++
-		}
+func fetchJSONWithHeaders(ctx context.Context, url string, headers map[string]string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
 	}
-	return count
-}
-
-var httpClient = &http.Client{Timeout: 5 * time.Second}
-
-func fetchJSON(url string, target interface{}) error {
-	resp, err := httpClient.Get(url)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -85,12 +45,21 @@ func fetchJSON(url string, target interface{}) error {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return &httpStatusError{Code: resp.StatusCode, Body: string(body)}
 	}
 
 	return json.NewDecoder(resp.Body).Decode(target)
 }
 
+func hasProvider(providers []*chainProvider, name string) bool {
+	for _, p := range providers {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
 // parseASN extracts ASN number from strings like "AS16509 Amazon.com, Inc."
 func parseASN(s string) int {
 	if len(s) < 3 {
@@ -116,7 +85,7 @@ func parseASN(s string) int {
 
 // ---- Provider Implementations ----
 
-func queryIPAPI(ip string) (*model.IPInfo, error) {
+func queryIPAPI(ctx context.Context, ip string) (*model.IPInfo, error) {
 	url := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,country,countryCode,city,isp,org,as,hosting,proxy", ip)
 	var resp struct {
 		Status      string `json:"status"`
@@ -130,7 +99,7 @@ func queryIPAPI(ip string) (*model.IPInfo, error) {
 		Hosting     bool   `json:"hosting"`
 		Proxy       bool   `json:"proxy"`
 	}
-	if err := fetchJSON(url, &resp); err != nil {
+	if err := fetchJSON(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Status != "success" {
@@ -144,7 +113,7 @@ func queryIPAPI(ip string) (*model.IPInfo, error) {
 	}, nil
 }
 
-func queryIPWhois(ip string) (*model.IPInfo, error) {
+func queryIPWhois(ctx context.Context, ip string) (*model.IPInfo, error) {
 	url := fmt.Sprintf("https://ipwhois.app/json/%s?security=1", ip)
 	var resp struct {
 		Success     bool   `json:"success"`
@@ -162,20 +131,20 @@ func queryIPWhois(ip string) (*model.IPInfo, error) {
 			Hosting   bool `json:"hosting"`
 		} `json:"security"`
 	}
-	if err := fetchJSON(url, &resp); err != nil {
+	if err := fetchJSON(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	return &model.IPInfo{
 		IP: ip, IsDatacenter: resp.Security.Hosting,
 		IsProxy: resp.Security.Proxy || resp.Security.Anonymous,
-		IsVPN: resp.Security.VPN, IsTor: resp.Security.Tor,
+		IsVPN:   resp.Security.VPN, IsTor: resp.Security.Tor,
 		ASN: parseASN(resp.ASN), ASNOrg: resp.Org, ISP: resp.ISP,
 		Country: resp.Country, CountryCode: resp.CountryCode, City: resp.City,
 		Source: "ipwhois",
 	}, nil
 }
 
-func queryFreeIPAPI(ip string) (*model.IPInfo, error) {
+func queryFreeIPAPI(ctx context.Context, ip string) (*model.IPInfo, error) {
 	url := fmt.Sprintf("https://freeipapi.com/api/json/%s", ip)
 	var resp struct {
 		CountryName string `json:"countryName"`
@@ -183,7 +152,7 @@ func queryFreeIPAPI(ip string) (*model.IPInfo, error) {
 		CityName    string `json:"cityName"`
 		IsProxy     bool   `json:"isProxy"`
 	}
-	if err := fetchJSON(url, &resp); err != nil {
+	if err := fetchJSON(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	return &model.IPInfo{
@@ -193,7 +162,7 @@ func queryFreeIPAPI(ip string) (*model.IPInfo, error) {
 	}, nil
 }
 
-func queryIPAPICo(ip string) (*model.IPInfo, error) {
+func queryIPAPICo(ctx context.Context, ip string) (*model.IPInfo, error) {
 	url := fmt.Sprintf("https://ipapi.co/%s/json/", ip)
 	var resp struct {
 		Country     string `json:"country_name"`
@@ -202,7 +171,7 @@ func queryIPAPICo(ip string) (*model.IPInfo, error) {
 		Org         string `json:"org"`
 		ASN         string `json:"asn"`
 	}
-	if err := fetchJSON(url, &resp); err != nil {
+	if err := fetchJSON(ctx, url, &resp); err != nil {
 		return nil, err
 	}
 	asn := parseASN(resp.ASN)
@@ -217,8 +186,8 @@ func queryIPAPICo(ip string) (*model.IPInfo, error) {
 	return info, nil
 }
 
-func makeQueryIPData(apiKey string) func(string) (*model.IPInfo, error) {
-	return func(ip string) (*model.IPInfo, error) {
+func makeQueryIPData(apiKey string) func(context.Context, string) (*model.IPInfo, error) {
+	return func(ctx context.Context, ip string) (*model.IPInfo, error) {
 		url := fmt.Sprintf("https://api.ipdata.co/%s?api-key=%s", ip, apiKey)
 		var resp struct {
 			Country     string `json:"country_name"`
@@ -236,7 +205,7 @@ func makeQueryIPData(apiKey string) func(string) (*model.IPInfo, error) {
 				IsTor        bool `json:"is_tor"`
 			} `json:"threat"`
 		}
-		if err := fetchJSON(url, &resp); err != nil {
+		if err := fetchJSON(ctx, url, &resp); err != nil {
 			return nil, err
 		}
 		return &model.IPInfo{
@@ -249,8 +218,8 @@ func makeQueryIPData(apiKey string) func(string) (*model.IPInfo, error) {
 	}
 }
 
-func makeQueryIPInfo(token string) func(string) (*model.IPInfo, error) {
-	return func(ip string) (*model.IPInfo, error) {
+func makeQueryIPInfo(token string) func(context.Context, string) (*model.IPInfo, error) {
+	return func(ctx context.Context, ip string) (*model.IPInfo, error) {
 		url := fmt.Sprintf("https://ipinfo.io/%s?token=%s", ip, token)
 		var resp struct {
 			City    string `json:"city"`
@@ -264,13 +233,13 @@ func makeQueryIPInfo(token string) func(string) (*model.IPInfo, error) {
 				Hosting bool `json:"hosting"`
 			} `json:"privacy"`
 		}
-		if err := fetchJSON(url, &resp); err != nil {
+		if err := fetchJSON(ctx, url, &resp); err != nil {
 			return nil, err
 		}
 		return &model.IPInfo{
 			IP: ip, IsDatacenter: resp.Privacy.Hosting,
 			IsProxy: resp.Privacy.Proxy || resp.Privacy.Relay,
-			IsVPN: resp.Privacy.VPN, IsTor: resp.Privacy.Tor,
+			IsVPN:   resp.Privacy.VPN, IsTor: resp.Privacy.Tor,
 			ASN: parseASN(resp.Org), ASNOrg: resp.Org, ISP: resp.Org,
 			Country: resp.Country, City: resp.City,
 			Source: "ipinfo",
@@ -278,36 +247,70 @@ func makeQueryIPInfo(token string) func(string) (*model.IPInfo, error) {
 	}
 }
 
-// InitProviders builds the provider chain based on config.
-func InitProviders(cfg *config.Config) []*Provider {
-	providers := []*Provider{
-		{Name: "ip-api", QueryFn: queryIPAPI, RateLimit: 40, HasKey: true},
-		{Name: "ipwhois", QueryFn: queryIPWhois, RateLimit: 40, HasKey: true},
-		{Name: "freeipapi", QueryFn: queryFreeIPAPI, RateLimit: 55, HasKey: true},
-		{Name: "ipapi-co", QueryFn: queryIPAPICo, RateLimit: 25, HasKey: true},
-	}
+func init() {
+	Register("ip-api", func(*config.Config) Provider {
+		return &FuncProvider{ProviderName: "ip-api", QueryFn: queryIPAPI,
+			Detects: DetectsDatacenter | DetectsProxy,
+			Limits:  Quota{PerMinute: 40, HasKey: true}}
+	})
+	Register("ipwhois", func(*config.Config) Provider {
+		return &FuncProvider{ProviderName: "ipwhois", QueryFn: queryIPWhois,
+			Detects: DetectsDatacenter | DetectsProxy | DetectsVPN | DetectsTor,
+			Limits:  Quota{PerMinute: 40, HasKey: true}}
+	})
+	Register("freeipapi", func(*config.Config) Provider {
+		return &FuncProvider{ProviderName: "freeipapi", QueryFn: queryFreeIPAPI,
+			Detects: DetectsProxy,
+			Limits:  Quota{PerMinute: 55, HasKey: true}}
+	})
+	Register("ipapi-co", func(*config.Config) Provider {
+		return &FuncProvider{ProviderName: "ipapi-co", QueryFn: queryIPAPICo,
+			Detects: DetectsDatacenter,
+			Limits:  Quota{PerMinute: 25, HasKey: true}}
+	})
+	Register("ipdata", func(cfg *config.Config) Provider {
+		return &FuncProvider{ProviderName: "ipdata", QueryFn: makeQueryIPData(cfg.IPDataAPIKey),
+			Detects: DetectsDatacenter | DetectsProxy | DetectsTor,
+			Limits:  Quota{PerDay: 1500, NeedsKey: true, HasKey: cfg.IPDataAPIKey != ""}}
+	})
+	Register("ipinfo", func(cfg *config.Config) Provider {
+		return &FuncProvider{ProviderName: "ipinfo", QueryFn: makeQueryIPInfo(cfg.IPInfoToken),
+			Detects: DetectsDatacenter | DetectsProxy | DetectsVPN | DetectsTor,
+			Limits:  Quota{PerMonth: 50000, NeedsKey: true, HasKey: cfg.IPInfoToken != ""}}
+	})
+}
 
-	if cfg.IPDataAPIKey != "" {
-		providers = append(providers, &Provider{
-			Name: "ipdata", QueryFn: makeQueryIPData(cfg.IPDataAPIKey), NeedsKey: true, HasKey: true,
-		})
-	} else {
-		providers = append(providers, &Provider{Name: "ipdata", NeedsKey: true})
+// buildChain instantiates every registered provider and orders the chain
+// based on config.
+func buildChain(cfg *config.Config) []*chainProvider {
+	var providers []*chainProvider
+	for _, r := range registered() {
+		p := r.factory(cfg)
+		if p == nil {
+			continue
+		}
+		providers = append(providers, newChainProvider(p, cfg))
 	}
 
-	if cfg.IPInfoToken != "" {
-		providers = append(providers, &Provider{
-			Name: "ipinfo", QueryFn: makeQueryIPInfo(cfg.IPInfoToken), NeedsKey: true, HasKey: true,
-		})
-	} else {
-		providers = append(providers, &Provider{Name: "ipinfo", NeedsKey: true})
+	if cfg.ProvidersFile != "" {
+		declared, err := loadDeclarativeProviders(cfg.ProvidersFile)
+		if err != nil {
+			log.Printf("[providers] WARNING: Failed to load %s: %v", cfg.ProvidersFile, err)
+		}
+		for _, p := range declared {
+			if hasProvider(providers, p.Name()) {
+				log.Printf("[providers] WARNING: %s from %s duplicates an existing provider, skipped", p.Name(), cfg.ProvidersFile)
+				continue
+			}
+			providers = append(providers, newChainProvider(p, cfg))
+		}
 	}
 
 	if len(cfg.EnabledProviders) > 0 {
-		reordered := make([]*Provider, 0, len(providers))
-		provMap := make(map[string]*Provider)
+		reordered := make([]*chainProvider, 0, len(providers))
+		provMap := make(map[string]*chainProvider)
 		for _, p := range providers {
-			provMap[p.Name] = p
+			provMap[p.Name()] = p
 		}
 		for _, name := range cfg.EnabledProviders {
 			if p, ok := provMap[name]; ok {
@@ -316,7 +319,7 @@ func InitProviders(cfg *config.Config) []*Provider {
 			}
 		}
 		for _, p := range providers {
-			if _, ok := provMap[p.Name]; ok {
+			if _, ok := provMap[p.Name()]; ok {
 				reordered = append(reordered, p)
 			}
 		}
@@ -325,11 +328,13 @@ func InitProviders(cfg *config.Config) []*Provider {
 
 	log.Printf("[providers] Initialized %d providers", len(providers))
 	for _, p := range providers {
+		q := p.Quota()
 		status := "ready"
-		if p.NeedsKey && !p.HasKey {
+		if q.NeedsKey && !q.HasKey {
 			status = "no key"
 		}
-		log.Printf("[providers]   %s (rate_limit=%d/min, %s)", p.Name, p.RateLimit, status)
+		log.Printf("[providers]   %s (rate_limit=%d/min, quota=%d/day %d/month, %s)",
+			p.Name(), q.PerMinute, p.daily.limit, p.monthly.limit, status)
 	}
 
 	// Commercial use notice
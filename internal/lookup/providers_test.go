@@ -0,0 +1,63 @@
+package lookup
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/config"
+)
+
+func TestAcquireRespectsRateLimitUnderConcurrency(t *testing.T) {
+	p := &chainProvider{Provider: &FuncProvider{ProviderName: "test", Limits: Quota{PerMinute: 10, HasKey: true}}}
+
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.Acquire() {
+				granted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := granted.Load(); got != 10 {
+		t.Fatalf("granted %d calls, want 10", got)
+	}
+	if p.Available() {
+		t.Fatal("provider should be unavailable after exhausting its rate limit")
+	}
+}
+
+func TestAcquireRejectsProviderWithoutKey(t *testing.T) {
+	p := &chainProvider{Provider: &FuncProvider{ProviderName: "keyed", Limits: Quota{NeedsKey: true}}}
+	if p.Acquire() {
+		t.Fatal("provider without key should not be acquired")
+	}
+}
+
+func TestRegisterRejectsDuplicateNames(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a built-in name again should panic")
+		}
+	}()
+	Register("ip-api", func(*config.Config) Provider { return nil })
+}
+
+func TestBuildChainHonorsEnabledProvidersOrder(t *testing.T) {
+	chain := buildChain(&config.Config{EnabledProviders: []string{"ipwhois", "ipapi-co"}})
+
+	var names []string
+	for _, p := range chain {
+		names = append(names, p.Name())
+	}
+	want := []string{"ipwhois", "ipapi-co", "ip-api", "freeipapi", "ipdata", "ipinfo"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("chain order = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,121 @@
+package lookup
+
+import (
+	"context"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// usageStore persists provider quota usage so counters survive restarts.
+// store.Store implements it.
+type usageStore interface {
+	GetUsage(ctx context.Context, provider, period string) int
+	AddUsage(ctx context.Context, provider, period string, n int)
+}
+
+// quotaWindow counts calls in the current calendar day or month (UTC).
+// It is guarded by the owning chainProvider's mutex.
+type quotaWindow struct {
+	limit  int    // max calls per period, 0 = unlimited
+	prefix string // "day" or "month"
+	layout string // time layout of the period, e.g. "2006-01-02"
+
+	period string // current period key, e.g. "day:2026-10-16"
+	used   int
+}
+
+func newDailyWindow(limit int) quotaWindow {
+	return quotaWindow{limit: limit, prefix: "day", layout: "2006-01-02"}
+}
+
+func newMonthlyWindow(limit int) quotaWindow {
+	return quotaWindow{limit: limit, prefix: "month", layout: "2006-01"}
+}
+
+// key returns the period key for t.
+func (w *quotaWindow) key(t time.Time) string {
+	return w.prefix + ":" + t.UTC().Format(w.layout)
+}
+
+// roll resets the counter when a new period starts.
+func (w *quotaWindow) roll(now time.Time) {
+	if k := w.key(now); k != w.period {
+		w.period = k
+		w.used = 0
+	}
+}
+
+func (w *quotaWindow) exhausted() bool {
+	return w.limit > 0 && w.used >= w.limit
+}
+
+// status returns the window for stats, or nil if it has no limit.
+func (w *quotaWindow) status() *model.QuotaWindow {
+	if w.limit <= 0 {
+		return nil
+	}
+	remaining := w.limit - w.used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &model.QuotaWindow{Period: w.period, Limit: w.limit, Used: w.used, Remaining: remaining}
+}
+
+// attachUsageStore loads the current period counters from s and persists
+// every future call to it.
+func (p *chainProvider) attachUsageStore(ctx context.Context, s usageStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.daily.limit <= 0 && p.monthly.limit <= 0 {
+		return
+	}
+	p.usage = s
+
+	now := time.Now()
+	for _, w := range []*quotaWindow{&p.daily, &p.monthly} {
+		if w.limit > 0 {
+			w.roll(now)
+			w.used = s.GetUsage(ctx, p.Name(), w.period)
+		}
+	}
+}
+
+// recordUsageLocked counts one call against the quota windows. It returns a
+// function persisting the call, to be run after releasing p.mu, or nil if
+// there is nothing to persist.
+// Caller must hold p.mu.
+func (p *chainProvider) recordUsageLocked() func() {
+	var periods []string
+	for _, w := range []*quotaWindow{&p.daily, &p.monthly} {
+		if w.limit > 0 {
+			w.used++
+			periods = append(periods, w.period)
+		}
+	}
+	if p.usage == nil || len(periods) == 0 {
+		return nil
+	}
+	name, s := p.Name(), p.usage
+	return func() {
+		for _, period := range periods {
+			s.AddUsage(context.Background(), name, period, 1)
+		}
+	}
+}
+
+// quotaStatus returns the quota windows for stats, or nil if unlimited.
+func (p *chainProvider) quotaStatus() *model.QuotaStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.daily.roll(now)
+	p.monthly.roll(now)
+	daily, monthly := p.daily.status(), p.monthly.status()
+	if daily == nil && monthly == nil {
+		return nil
+	}
+	return &model.QuotaStatus{Daily: daily, Monthly: monthly}
+}
@@ -0,0 +1,52 @@
+package lookup
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/config"
+	"github.com/akl7777777/ip-intel/internal/store"
+)
+
+func TestDailyQuotaPersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.NewSQLite(filepath.Join(t.TempDir(), "cache.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cfg := &config.Config{ProviderDailyQuotas: map[string]int{"keyed": 2}}
+	newProvider := func() *chainProvider {
+		p := newChainProvider(&FuncProvider{ProviderName: "keyed", Limits: Quota{PerMonth: 100, NeedsKey: true, HasKey: true}}, cfg)
+		p.attachUsageStore(ctx, s)
+		return p
+	}
+
+	p := newProvider()
+	if !p.Acquire() || !p.Acquire() {
+		t.Fatal("first two calls should be within quota")
+	}
+	if p.Acquire() {
+		t.Fatal("third call should exceed the daily quota")
+	}
+
+	status := p.quotaStatus()
+	if status.Daily.Remaining != 0 || status.Monthly.Used != 2 || status.Monthly.Remaining != 98 {
+		t.Fatalf("quota status = %+v / %+v", status.Daily, status.Monthly)
+	}
+
+	if got := s.GetUsage(ctx, "keyed", p.daily.period); got != 2 {
+		t.Fatalf("stored daily usage = %d, want 2", got)
+	}
+
+	restarted := newProvider()
+	if restarted.Available() {
+		t.Fatal("quota should still be exhausted after restart")
+	}
+	if got := restarted.quotaStatus().Monthly.Used; got != 2 {
+		t.Fatalf("monthly used after restart = %d, want 2", got)
+	}
+}
@@ -0,0 +1,203 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// SourceRDNS is the provenance of the hostname and of flags derived from it.
+const SourceRDNS = "rdns"
+
+// confidenceHostname is used for flags decided by a hostname rule. Reverse
+// DNS is controlled by the address owner and naming schemes vary, so it
+// ranks below the curated ASN lists.
+const confidenceHostname = 0.8
+
+// Hostname verdicts.
+const (
+	HostDatacenter  = "datacenter"
+	HostResidential = "residential"
+	HostVPN         = "vpn"
+)
+
+// HostnameRule classifies PTR hostnames. Pattern is a glob matched against
+// the whole lowercased hostname ("*" matches any characters, including
+// dots); Token matches one alphabetic label fragment, e.g. "dsl" matches
+// "dsl-187-1-2-3.example.net" but not "adsl".
+type HostnameRule struct {
+	Pattern string
+	Token   string
+	Verdict string
+}
+
+// HostnameRules are evaluated in order; the first match wins. Patterns for
+// well-known hosting naming schemes come before the generic tokens.
+var HostnameRules = []HostnameRule{
+	{Pattern: "*.compute.amazonaws.com", Verdict: HostDatacenter},
+	{Pattern: "*.compute-1.amazonaws.com", Verdict: HostDatacenter},
+	{Pattern: "*.bc.googleusercontent.com", Verdict: HostDatacenter},
+	{Pattern: "static.*.clients.your-server.de", Verdict: HostDatacenter},
+	{Pattern: "*.vultrusercontent.com", Verdict: HostDatacenter},
+	{Pattern: "*.ip.linodeusercontent.com", Verdict: HostDatacenter},
+	{Pattern: "*.members.linode.com", Verdict: HostDatacenter},
+	{Pattern: "*.contaboserver.net", Verdict: HostDatacenter},
+	{Pattern: "*.hostwindsdns.com", Verdict: HostDatacenter},
+	{Pattern: "*.vpn.*", Verdict: HostVPN},
+
+	{Token: "vpn", Verdict: HostVPN},
+	{Token: "dynamic", Verdict: HostResidential},
+	{Token: "dyn", Verdict: HostResidential},
+	{Token: "dsl", Verdict: HostResidential},
+	{Token: "adsl", Verdict: HostResidential},
+	{Token: "vdsl", Verdict: HostResidential},
+	{Token: "xdsl", Verdict: HostResidential},
+	{Token: "pool", Verdict: HostResidential},
+	{Token: "dhcp", Verdict: HostResidential},
+	{Token: "dialup", Verdict: HostResidential},
+	{Token: "ppp", Verdict: HostResidential},
+	{Token: "pppoe", Verdict: HostResidential},
+	{Token: "cable", Verdict: HostResidential},
+	{Token: "ftth", Verdict: HostResidential},
+	{Token: "broadband", Verdict: HostResidential},
+	{Token: "residential", Verdict: HostResidential},
+	{Token: "cpe", Verdict: HostResidential},
+	{Token: "vps", Verdict: HostDatacenter},
+	{Token: "dedicated", Verdict: HostDatacenter},
+	{Token: "hosting", Verdict: HostDatacenter},
+	{Token: "colo", Verdict: HostDatacenter},
+	{Token: "server", Verdict: HostDatacenter},
+}
+
+// classifyHostname returns the verdict of the first matching rule.
+func classifyHostname(hostname string) (HostnameRule, bool) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	tokens := make(map[string]bool)
+	for _, t := range strings.FieldsFunc(hostname, func(r rune) bool { return r < 'a' || r > 'z' }) {
+		tokens[t] = true
+	}
+	for _, r := range HostnameRules {
+		if r.Pattern != "" {
+			if ok, _ := path.Match(r.Pattern, hostname); ok {
+				return r, true
+			}
+		} else if tokens[r.Token] {
+			return r, true
+		}
+	}
+	return HostnameRule{}, false
+}
+
+// hostnameResult is the outcome of a PTR lookup.
+type hostnameResult struct {
+	Hostname string
+	Rule     HostnameRule // zero if no rule matched
+}
+
+// ptrResolver is implemented by *net.Resolver.
+type ptrResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// newPTRResolver returns a resolver that sends every query to addr
+// ("host" or "host:port"), or the system resolver if addr is empty.
+func newPTRResolver(addr string) ptrResolver {
+	if addr == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// lookupHostname resolves the PTR record of ip and classifies it. It returns
+// nil when reverse DNS is disabled, fails or times out.
+func (s *Service) lookupHostname(ctx context.Context, ip string) *hostnameResult {
+	if s.resolver == nil {
+		return nil
+	}
+	if s.rdnsTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.rdnsTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	names, err := s.resolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		// Missing PTR records are common, only log resolver trouble
+		var dnsErr *net.DNSError
+		if err != nil && ctx.Err() == nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			log.Printf("[rdns] %s: %v", ip, err)
+		}
+		return nil
+	}
+
+	r := &hostnameResult{Hostname: strings.TrimSuffix(names[0], ".")}
+	r.Rule, _ = classifyHostname(r.Hostname)
+	log.Printf("[rdns] %s → %s (%s, %s)", ip, r.Hostname, firstNonEmpty(r.Rule.Verdict, "no rule"), time.Since(start).Round(time.Millisecond))
+	return r
+}
+
+// startHostnameLookup runs lookupHostname in the background, so that the
+// PTR query overlaps the provider calls, and returns a function waiting for
+// its result.
+func (s *Service) startHostnameLookup(ctx context.Context, ip string) func() *hostnameResult {
+	if s.resolver == nil {
+		return func() *hostnameResult { return nil }
+	}
+	done := make(chan *hostnameResult, 1)
+	go func() { done <- s.lookupHostname(ctx, ip) }()
+	return func() *hostnameResult { return <-done }
+}
+
+// applyHostname records the hostname and, if the ASN lists do not classify
+// the ASN, applies the verdict of the matching hostname rule.
+func applyHostname(info *model.IPInfo, r *hostnameResult) {
+	if r == nil {
+		return
+	}
+	info.Hostname = r.Hostname
+	setProvenance(info, SourceRDNS, "hostname")
+	if r.Rule.Verdict == "" {
+		return
+	}
+	if _, known := LookupASN(info.ASN); known {
+		return
+	}
+
+	switch r.Rule.Verdict {
+	case HostDatacenter:
+		info.IsDatacenter = true
+		setProvenance(info, SourceRDNS, "is_datacenter")
+		setConfidence(info, "is_datacenter", confidenceHostname)
+		if info.UsageType == "" {
+			info.UsageType = string(UsageHosting)
+			setProvenance(info, SourceRDNS, "usage_type")
+		}
+	case HostResidential:
+		info.IsDatacenter = false
+		setProvenance(info, SourceRDNS, "is_datacenter")
+		setConfidence(info, "is_datacenter", confidenceHostname)
+		if info.UsageType == "" {
+			info.UsageType = string(UsageISP)
+			setProvenance(info, SourceRDNS, "usage_type")
+		}
+	case HostVPN:
+		info.IsVPN = true
+		setProvenance(info, SourceRDNS, "is_vpn")
+		setConfidence(info, "is_vpn", confidenceHostname)
+	}
+}
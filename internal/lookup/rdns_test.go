@@ -0,0 +1,169 @@
+package lookup
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// staticResolver answers PTR queries from a map.
+type staticResolver map[string]string
+
+func (r staticResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if name, ok := r[addr]; ok {
+		return []string{name + "."}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func TestClassifyHostname(t *testing.T) {
+	for host, want := range map[string]string{
+		"ec2-3-80-1-2.compute-1.amazonaws.com":     HostDatacenter,
+		"static.88-198-1-2.clients.your-server.de": HostDatacenter,
+		"vps-1234.example.net":                     HostDatacenter,
+		"dsl-187-1-2-3.dyn.example.net":            HostResidential,
+		"cpe-98-1-2-3.res.rr.com":                  HostResidential,
+		"node1.vpn.example.org":                    HostVPN,
+		"VPN-gw.example.org.":                      HostVPN,
+	} {
+		r, ok := classifyHostname(host)
+		if !ok || r.Verdict != want {
+			t.Errorf("classifyHostname(%q) = %q, %v, want %q", host, r.Verdict, ok, want)
+		}
+	}
+	// Tokens only match whole alphabetic fragments
+	for _, host := range []string{"mail.example.com", "adslgateway.example.com", "observer.example.com"} {
+		if r, ok := classifyHostname(host); ok {
+			t.Errorf("classifyHostname(%q) = %q, want no match", host, r.Verdict)
+		}
+	}
+}
+
+func TestLookupAppliesHostname(t *testing.T) {
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			asn := 64500 // not in the ASN lists
+			if ip == "93.184.100.3" {
+				asn = 16509 // Amazon, listed as datacenter
+			}
+			return &model.IPInfo{IP: ip, ASN: asn, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.resolver = staticResolver{
+		"93.184.100.1": "vps-17.example.net",
+		"93.184.100.2": "dsl-93-184-100-2.example.net",
+		"93.184.100.3": "dsl-pool.example.net",
+	}
+
+	info, err := svc.Lookup(context.Background(), "93.184.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Hostname != "vps-17.example.net" || !info.IsDatacenter || info.UsageType != "hosting" {
+		t.Fatalf("vps: hostname=%q datacenter=%v usage=%q", info.Hostname, info.IsDatacenter, info.UsageType)
+	}
+	if info.Provenance["is_datacenter"] != SourceRDNS || info.Confidence["is_datacenter"] != confidenceHostname {
+		t.Fatalf("provenance %v, confidence %v", info.Provenance, info.Confidence)
+	}
+
+	info, err = svc.Lookup(context.Background(), "93.184.100.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDatacenter || info.UsageType != "isp" || info.Provenance["hostname"] != SourceRDNS {
+		t.Fatalf("dsl: datacenter=%v usage=%q provenance=%v", info.IsDatacenter, info.UsageType, info.Provenance)
+	}
+
+	// The ASN lists outrank the hostname
+	info, err = svc.Lookup(context.Background(), "93.184.100.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDatacenter || info.Hostname != "dsl-pool.example.net" || info.Provenance["is_datacenter"] == SourceRDNS {
+		t.Fatalf("listed ASN: datacenter=%v hostname=%q provenance=%v", info.IsDatacenter, info.Hostname, info.Provenance)
+	}
+
+	// No PTR record
+	info, err = svc.Lookup(context.Background(), "93.184.100.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Hostname != "" {
+		t.Fatalf("hostname = %q, want empty", info.Hostname)
+	}
+}
+
+// gatedResolver answers only after release is closed.
+type gatedResolver struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (r *gatedResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.calls.Add(1)
+	select {
+	case <-r.release:
+		return []string{"vps-1.example.net."}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestLookupResolvesHostnameAlongsideProviders(t *testing.T) {
+	r := &gatedResolver{release: make(chan struct{})}
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			close(r.release) // the PTR query is still waiting
+			return &model.IPInfo{IP: ip, ASN: 64500, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.resolver = r
+	svc.rdnsTimeout = time.Second
+
+	info, err := svc.Lookup(context.Background(), "93.184.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Hostname != "vps-1.example.net" || !info.IsDatacenter {
+		t.Fatalf("hostname=%q datacenter=%v", info.Hostname, info.IsDatacenter)
+	}
+}
+
+func TestLookupSkipsHostnameForListedLocalASN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.mmdb")
+	testMMDB{
+		dbType:     "GeoLite2-ASN",
+		buildEpoch: 1700000000,
+		networks: map[string]map[string]interface{}{
+			"93.184.113.0/24": {
+				"autonomous_system_number":       4134,
+				"autonomous_system_organization": "CHINANET-BACKBONE",
+			},
+		},
+	}.write(t, path)
+
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			return &model.IPInfo{IP: ip, ASN: 4134, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.localDB = NewLocalDB([]string{path}, 0)
+	defer svc.localDB.Close()
+	r := &gatedResolver{release: make(chan struct{})}
+	close(r.release)
+	svc.resolver = r
+
+	if _, err := svc.Lookup(context.Background(), "93.184.113.10"); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.calls.Load(); n != 0 {
+		t.Fatalf("PTR queried %d times for a listed ASN", n)
+	}
+}
@@ -0,0 +1,193 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errRefreshFailed is returned by a refresh that found no fresh result.
+var errRefreshFailed = errors.New("refresh failed: no provider answered")
+
+const (
+	// maxRefreshes bounds the background refreshes running at once.
+	maxRefreshes = 4
+	// hotRefreshBatch bounds the entries renewed per hot refresh round.
+	hotRefreshBatch = 256
+)
+
+// refresher runs background refreshes of cached results, at most one per IP
+// and maxRefreshes at once.
+type refresher struct {
+	sem     chan struct{}
+	mu      sync.Mutex
+	pending map[string]struct{}
+
+	// Refreshes run on ctx, canceled by Close, which waits for them via wg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	refreshes atomic.Int64 // completed with a fresh result
+	failures  atomic.Int64
+
+	// Proactive refresh of hot entries, disabled when hotHits is 0
+	hotHits     int64
+	hotInterval time.Duration
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func newRefresher(hotHits int64, hotInterval time.Duration) *refresher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &refresher{
+		sem:         make(chan struct{}, maxRefreshes),
+		pending:     make(map[string]struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		hotHits:     hotHits,
+		hotInterval: hotInterval,
+		stopCh:      make(chan struct{}),
+	}
+}
+
+// claim marks ip as being refreshed; it reports false if it already is.
+func (r *refresher) claim(ip string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pending[ip]; ok {
+		return false
+	}
+	r.pending[ip] = struct{}{}
+	return true
+}
+
+func (r *refresher) release(ip string) {
+	r.mu.Lock()
+	delete(r.pending, ip)
+	r.mu.Unlock()
+}
+
+// start registers a refresh about to run; it reports false once Close was
+// called.
+func (r *refresher) start() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return false
+	}
+	r.wg.Add(1)
+	return true
+}
+
+// Close stops the hot refresh loop, cancels running refreshes and waits for
+// them to return. Safe to call on a nil refresher.
+func (r *refresher) Close() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		r.cancel()
+		r.mu.Unlock()
+		close(r.stopCh)
+	})
+	r.wg.Wait()
+}
+
+// revalidate renews the cached result for ip in the background. It does
+// nothing if a refresh of ip is running or all refresh slots are busy; the
+// next stale hit tries again.
+func (s *Service) revalidate(ip string) {
+	s.startRefresh(ip, false)
+}
+
+// startRefresh runs refresh(ip) in the background unless a refresh of ip is
+// running. If all slots are busy it waits for one, or gives up if !wait.
+func (s *Service) startRefresh(ip string, wait bool) {
+	r := s.refresher
+	if r == nil || !r.claim(ip) {
+		return
+	}
+	if wait {
+		select {
+		case r.sem <- struct{}{}:
+		case <-r.stopCh:
+			r.release(ip)
+			return
+		}
+	} else {
+		select {
+		case r.sem <- struct{}{}:
+		default:
+			r.release(ip)
+			return
+		}
+	}
+	if !r.start() {
+		<-r.sem
+		r.release(ip)
+		return
+	}
+	go func() {
+		defer func() {
+			<-r.sem
+			r.release(ip)
+			r.wg.Done()
+		}()
+		s.refresh(ip)
+	}()
+}
+
+// revalidateStored renews a persistent cache result older than the soft TTL.
+func (s *Service) revalidateStored(ip string, storedAt time.Time) {
+	if s.storeSoftTTL > 0 && time.Since(storedAt) > s.storeSoftTTL {
+		s.staleHits.Add(1)
+		s.revalidate(ip)
+	}
+}
+
+// refresh runs the lookup pipeline for ip bypassing the caches. A fresh
+// result replaces the cached one; on failure the stale result stays. The
+// lookup is canceled when the refresher is closed.
+func (s *Service) refresh(ip string) {
+	info, err := s.resolve(s.refresher.ctx, ip, true)
+	if err != nil {
+		if s.refresher.ctx.Err() != nil {
+			return // shutting down
+		}
+		s.refresher.failures.Add(1)
+		log.Printf("[refresh] %s: %v", ip, err)
+		return
+	}
+	s.refresher.refreshes.Add(1)
+	log.Printf("[refresh] %s → %s", ip, info.Source)
+}
+
+// refreshHot periodically renews entries that were read at least hotHits
+// times and expire before the next round, so popular addresses never wait
+// for the providers.
+func (s *Service) refreshHot() {
+	r := s.refresher
+	ticker := time.NewTicker(r.hotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, key := range s.cache.Hot(now.Add(2*r.hotInterval), r.hotHits, hotRefreshBatch) {
+				if strings.Contains(key, "/") {
+					continue // shared network entry, renewed through its addresses
+				}
+				s.startRefresh(key, true)
+			}
+		case <-r.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/cache"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// waitFor polls cond for up to two seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// countingProvider answers with ASN = number of calls, or fails while failing is set.
+func countingProvider(calls *atomic.Int32, failing *atomic.Bool) *FuncProvider {
+	return &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 1000, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			n := calls.Add(1)
+			if failing != nil && failing.Load() {
+				return nil, errors.New("unavailable")
+			}
+			return &model.IPInfo{IP: ip, ASN: int(n), Source: "api"}, nil
+		}}
+}
+
+func TestLookupServesStaleWhileRevalidating(t *testing.T) {
+	var calls atomic.Int32
+	var failing atomic.Bool
+	svc := newTestService(t, countingProvider(&calls, &failing))
+	svc.softTTL = 10 * time.Millisecond
+	svc.refresher = newRefresher(0, 0)
+	ctx := context.Background()
+
+	if _, err := svc.Lookup(ctx, "93.184.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// The stale result is served at once and renewed in the background
+	info, err := svc.Lookup(ctx, "93.184.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ASN != 1 || !info.Cached {
+		t.Fatalf("stale hit: asn=%d cached=%v", info.ASN, info.Cached)
+	}
+	waitFor(t, "refresh", func() bool {
+		cached, ok := svc.cache.Peek("93.184.100.1")
+		return ok && cached.ASN == 2
+	})
+	if svc.staleHits.Load() != 1 || svc.refresher.refreshes.Load() != 1 {
+		t.Fatalf("stale hits %d, refreshes %d", svc.staleHits.Load(), svc.refresher.refreshes.Load())
+	}
+
+	// A failed refresh keeps the stale result
+	failing.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := svc.Lookup(ctx, "93.184.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "failed refresh", func() bool { return svc.refresher.failures.Load() == 1 })
+	if cached, ok := svc.cache.Peek("93.184.100.1"); !ok || cached.ASN != 2 {
+		t.Fatalf("after failed refresh: %+v, %v", cached, ok)
+	}
+}
+
+func TestRefreshHotEntriesBeforeExpiry(t *testing.T) {
+	var calls atomic.Int32
+	svc := newTestService(t, countingProvider(&calls, nil))
+	svc.cache = cache.New(300*time.Millisecond, 0, 0)
+	t.Cleanup(svc.cache.Stop)
+	svc.refresher = newRefresher(2, 50*time.Millisecond)
+	t.Cleanup(svc.refresher.Close)
+	go svc.refreshHot()
+	ctx := context.Background()
+
+	for _, ip := range []string{"93.184.100.1", "93.184.100.1", "93.184.100.1", "93.184.100.2"} {
+		if _, err := svc.Lookup(ctx, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the address read twice since it was stored is renewed
+	waitFor(t, "hot refresh", func() bool { return svc.refresher.refreshes.Load() >= 1 })
+	if cached, ok := svc.cache.Peek("93.184.100.1"); !ok || cached.ASN < 3 {
+		t.Fatalf("hot entry not renewed: %+v, %v", cached, ok)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if _, ok := svc.cache.Peek("93.184.100.2"); ok {
+		t.Fatal("cold entry was renewed")
+	}
+}
+
+func TestRefresherCloseCancelsRunningRefreshes(t *testing.T) {
+	started := make(chan struct{})
+	svc := newTestService(t, &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}})
+	svc.refresher = newRefresher(0, 0)
+
+	svc.revalidate("93.184.100.1")
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		svc.refresher.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not cancel the running refresh")
+	}
+	if n := svc.refresher.failures.Load(); n != 0 {
+		t.Fatalf("failures = %d after shutdown", n)
+	}
+
+	// No refresh starts once closed
+	svc.revalidate("93.184.100.2")
+	if len(svc.refresher.pending) != 0 {
+		t.Fatalf("pending = %v", svc.refresher.pending)
+	}
+}
@@ -1,28 +1,111 @@
 package lookup
 
 import (
+	"context"
+	"errors"
 	"log"
+	"sync/atomic"
+	"time"
 
 	"github.com/akl7777777/ip-intel/internal/cache"
 	"github.com/akl7777777/ip-intel/internal/config"
+	"github.com/akl7777777/ip-intel/internal/iptrie"
 	"github.com/akl7777777/ip-intel/internal/model"
 	"github.com/akl7777777/ip-intel/internal/store"
 )
 
 // Service is the core IP intelligence lookup service.
 type Service struct {
-	cache     *cache.Cache
-	store     store.Store // persistent cache (SQLite/MySQL), may be nil
-	localDB   *LocalDB
-	providers []*Provider
+	cache    *cache.Cache
+	negative *cache.Cache // failed lookups, nil when NEGATIVE_CACHE_TTL_SECONDS is 0
+	store    store.Store  // persistent cache (SQLite/MySQL), may be nil
+	localDB  *LocalDB
+	asnLists *asnListLoader         // nil when ASN_LIST_FILES is not set
+	ranges   *cloudRangeLoader      // nil when CLOUD_RANGE_FILES is not set
+	orgs     *orgScorer             // nil when organization-name scoring is disabled
+	torExits *torExitList           // nil when TOR_EXIT_LIST is not set
+	bogons   *iptrie.Trie[struct{}] // nil when BOGON_FILES is not set
+	resolver ptrResolver            // nil when reverse DNS is disabled
+
+	rdnsTimeout time.Duration // deadline for one PTR lookup, 0 = lookup deadline only
+	providers   []*chainProvider
+	flights     *flightGroup
+	overrides   *overrideSet
+
+	lookupTimeout time.Duration // overall deadline for one Lookup, 0 = none
+
+	// Prefix lengths whose networks share cache entries, 0 = exact IPs only
+	prefixV4 int
+	prefixV6 int
+
+	// Stale-while-revalidate, see refresh.go
+	softTTL      time.Duration // in-memory entries older than this are renewed in the background, 0 = never
+	storeSoftTTL time.Duration // the same for persistent cache entries
+	refresher    *refresher    // nil when neither soft TTL nor hot refresh is enabled
+	staleHits    atomic.Int64
+
+	// Consensus mode, enabled when consensusN > 1
+	consensusN int
+	quorum     float64
+	weights    map[string]float64
 }
 
 // NewService creates a new service instance.
 func NewService(cfg *config.Config) *Service {
 	svc := &Service{
-		cache:     cache.New(cfg.CacheTTL),
-		localDB:   NewLocalDB(cfg.MMDBPath),
-		providers: InitProviders(cfg),
+		cache:     cache.New(cfg.CacheTTL, cfg.CacheMaxEntries, cfg.CacheMaxBytes),
+		negative:  newNegativeCache(cfg.NegativeCacheTTL),
+		localDB:   NewLocalDB(append([]string{cfg.MMDBPath}, cfg.MMDBGeoPaths...), cfg.MMDBReloadInterval),
+		providers: buildChain(cfg),
+		flights:   newFlightGroup(),
+		overrides: newOverrideSet(),
+
+		lookupTimeout: cfg.LookupTimeout,
+		rdnsTimeout:   cfg.RDNSTimeout,
+
+		prefixV4: validPrefixLen(cfg.CachePrefixV4, 32, "CACHE_PREFIX_V4"),
+		prefixV6: validPrefixLen(cfg.CachePrefixV6, 128, "CACHE_PREFIX_V6"),
+
+		softTTL:      cfg.CacheSoftTTL,
+		storeSoftTTL: cfg.PersistentCacheSoftTTL,
+
+		consensusN: cfg.ConsensusProviders,
+		quorum:     cfg.ConsensusQuorum,
+		weights:    cfg.ProviderWeights,
+	}
+
+	if len(cfg.ASNListFiles) > 0 {
+		svc.asnLists = newASNListLoader(cfg.ASNListFiles, cfg.ASNListReloadInterval)
+	}
+	if len(cfg.CloudRangeFiles) > 0 {
+		svc.ranges = newCloudRangeLoader(cfg.CloudRangeFiles, cfg.CloudRangeReloadInterval)
+	}
+	svc.orgs = loadOrgScorer(cfg.OrgNameRulesFile, cfg.OrgHostingThreshold)
+	if cfg.RDNSEnabled {
+		svc.resolver = newPTRResolver(cfg.RDNSResolver)
+	}
+	if len(cfg.BogonFiles) > 0 {
+		bogons, err := loadBogons(cfg.BogonFiles)
+		if err != nil {
+			log.Printf("[lookup] WARNING: Failed to load bogon lists: %v", err)
+		} else {
+			svc.bogons = bogons
+			log.Printf("[lookup] Loaded %d bogon prefixes", bogons.Len())
+		}
+	}
+	if cfg.TorExitList != "" {
+		svc.torExits = newTorExitList(cfg.TorExitList, cfg.TorExitListRefresh)
+	}
+
+	if svc.softTTL > 0 || svc.storeSoftTTL > 0 || cfg.CacheRefreshHotHits > 0 {
+		svc.refresher = newRefresher(int64(cfg.CacheRefreshHotHits), cfg.CacheRefreshInterval)
+		if cfg.CacheRefreshHotHits > 0 && cfg.CacheRefreshInterval > 0 {
+			go svc.refreshHot()
+		}
+	}
+
+	if svc.consensusN > 1 {
+		log.Printf("[lookup] Consensus mode: %d providers, quorum %.2f", svc.consensusN, svc.quorum)
 	}
 
 	if cfg.PersistentCache {
@@ -31,6 +114,11 @@ func NewService(cfg *config.Config) *Service {
 			log.Printf("[store] WARNING: Failed to open persistent cache: %v", err)
 		} else {
 			svc.store = s
+			svc.loadOverrides(context.Background())
+			// Quota counters survive restarts when a persistent store is available
+			for _, p := range svc.providers {
+				p.attachUsageStore(context.Background(), s)
+			}
 		}
 	}
 
@@ -38,131 +126,273 @@ func NewService(cfg *config.Config) *Service {
 }
 
 // Lookup performs an IP intelligence lookup.
-// Order: cache → local MMDB + ASN list → persistent cache → external API chain.
-func (s *Service) Lookup(ip string) (*model.IPInfo, error) {
-	// 1. Check in-memory cache
-	if info, ok := s.cache.Get(ip); ok {
+// Special-purpose and bogon addresses are answered without any lookup, and
+// IPv4 addresses embedded in IPv6 (mapped, NAT64, 6to4, Teredo) are looked up
+// as IPv4.
+// Order: cache → local MMDB + ASN list → admin overrides → Tor exit list →
+// persistent cache → reverse DNS → external API chain.
+// When every provider fails the minimal result is kept in the negative cache
+// for NEGATIVE_CACHE_TTL_SECONDS.
+// Concurrent lookups of the same uncached IP are coalesced into one. If ctx is
+// canceled (e.g. the client disconnected) ctx.Err() is returned, and in-flight
+// provider calls are aborted once no other caller waits for them.
+func (s *Service) Lookup(ctx context.Context, ip string) (*model.IPInfo, error) {
+	if info, handled, err := s.lookupSpecial(ctx, ip); handled {
+		return info, err
+	}
+	if info, hit, ok := s.cacheGet(ip); ok {
+		if s.softTTL > 0 && hit.Age > s.softTTL {
+			// Serve the stale result, renew it in the background
+			s.staleHits.Add(1)
+			s.revalidate(ip)
+		}
+		return info, nil
+	}
+	if info, ok := s.negativeGet(ip); ok {
+		return info, nil
+	}
+	return s.flights.do(ctx, ip, func(ctx context.Context) (*model.IPInfo, error) {
+		return s.resolve(ctx, ip, false)
+	})
+}
+
+// resolve runs the lookup pipeline for one IP, bounded by the lookup timeout.
+// A refresh skips the caches and, if all providers fail, returns
+// errRefreshFailed instead of replacing the cached result with a degraded one.
+func (s *Service) resolve(ctx context.Context, ip string, refresh bool) (*model.IPInfo, error) {
+	if s.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.lookupTimeout)
+		defer cancel()
+	}
+
+	// 1. Check in-memory cache, another lookup may have filled it meanwhile
+	if info, ok := s.cache.Peek(ip); ok && !refresh {
+		return info, nil
+	}
+
+	// 2. Try local MMDB + datacenter ASN list + published cloud ranges
+	var local *model.IPInfo
+	if s.localDB.Loaded() {
+		if info, err := s.localDB.Lookup(ip, s.ranges, s.orgs); err == nil {
+			local = info
+		}
+	}
+	// Published cloud ranges don't need the MMDB
+	if local == nil {
+		if r, ok := s.ranges.match(ip); ok {
+			local = &model.IPInfo{IP: ip, Source: "local"}
+			markCloudRange(local, r)
+		}
+	}
+
+	// Admin overrides are definitive, no need for API
+	var localASN int
+	if local != nil {
+		localASN = local.ASN
+	}
+	if o, ok := s.overrides.match(ip, localASN); ok {
+		info := local
+		if info == nil {
+			info = &model.IPInfo{IP: ip}
+		}
+		info.Source = SourceOverride
+		applyOverride(info, o)
+		s.cacheSet(ip, info)
+		log.Printf("[lookup] %s → override (%s %s)", ip, overrideTarget(o), o.Category)
 		return info, nil
 	}
 
-	// 2. Try local MMDB + datacenter ASN list
-	if s.localDB != nil {
-		info, err := s.localDB.Lookup(ip)
-		if err == nil && info.IsDatacenter {
+	// Listed Tor exits are definitive, no need for API
+	if s.torExits.Contains(ip) {
+		info := local
+		if info == nil {
+			info = &model.IPInfo{IP: ip, Source: SourceTorList}
+		}
+		markTorExit(info)
+		s.cacheSet(ip, info)
+		log.Printf("[lookup] %s → Tor exit list", ip)
+		return info, nil
+	}
+
+	if info := local; info != nil {
+		if info.IsDatacenter {
 			// Definitively a datacenter IP, no need for API
-			s.cache.Set(ip, info)
+			s.cacheSet(ip, info)
 			log.Printf("[lookup] %s → local (datacenter: ASN %d %s)", ip, info.ASN, info.ASNOrg)
 			return info, nil
 		}
 		// MMDB gave us ASN info but not conclusive about datacenter
 		// Continue to persistent cache / API for proxy/VPN detection
-		if err == nil {
-			// 3. Check persistent cache before hitting external APIs
-			if s.store != nil {
-				if stored, ok := s.store.Get(ip); ok {
-					// Merge local ASN info if persistent cache missed it
-					if stored.ASN == 0 {
-						stored.ASN = info.ASN
-						stored.ASNOrg = info.ASNOrg
-					}
-					// Known residential ISP overrides stale datacenter flag in cache
-					if org, ok := IsKnownResidentialASN(stored.ASN); ok {
-						stored.IsDatacenter = false
-						stored.ISP = org
-					}
-					stored.Cached = true
-					s.cache.Set(ip, stored)
-					log.Printf("[lookup] %s → persistent cache (source=%s)", ip, stored.Source)
-					return stored, nil
-				}
-			}
 
-			// 4. Try external API for enrichment
-			enriched := s.queryProviders(ip)
-			if enriched != nil {
-				// Merge: keep API's proxy/vpn/datacenter flags, fill in ASN from local if API missed it
-				if enriched.ASN == 0 {
-					enriched.ASN = info.ASN
-					enriched.ASNOrg = info.ASNOrg
+		// 3. Check persistent cache before hitting external APIs
+		if s.store != nil && !refresh {
+			if stored, storedAt, ok := s.storeGet(ctx, ip); ok {
+				markFromPersistentCache(stored)
+				// Merge local ASN info if persistent cache missed it
+				mergeLocalASN(stored, info)
+				mergeLocalGeo(stored, info)
+				// Known residential ISP overrides stale datacenter flag in cache
+				if org, ok := IsKnownResidentialASN(stored.ASN); ok {
+					markResidentialASN(stored, org)
 				}
-				// Known residential ISP overrides external API's datacenter misclassification
-				if org, ok := IsKnownResidentialASN(enriched.ASN); ok {
-					enriched.IsDatacenter = false
-					enriched.ISP = org
-				}
-				s.cache.Set(ip, enriched)
-				s.persistResult(ip, enriched)
-				return enriched, nil
+				setUsageType(stored)
+				stored.Cached = true
+				s.cacheSet(ip, stored)
+				log.Printf("[lookup] %s → persistent cache (source=%s)", ip, stored.Source)
+				s.revalidateStored(ip, storedAt)
+				return stored, nil
 			}
-			// All APIs failed, return local result
-			s.cache.Set(ip, info)
+		}
+
+		// Hosting hostnames settle ASNs the lists don't know, no need for API.
+		// For listed ASNs the hostname would be ignored, so it isn't resolved.
+		var host *hostnameResult
+		if _, known := LookupASN(info.ASN); !known {
+			host = s.lookupHostname(ctx, ip)
+		}
+		applyHostname(info, host)
+		if info.IsDatacenter {
+			s.cacheSet(ip, info)
+			log.Printf("[lookup] %s → local (datacenter: hostname %s)", ip, info.Hostname)
 			return info, nil
 		}
+
+		// 4. Try external API for enrichment
+		enriched := s.queryProviders(ctx, ip)
+		if enriched != nil {
+			// Merge: keep API's proxy/vpn/datacenter flags, fill in ASN and geo from local if API missed them
+			mergeLocalASN(enriched, info)
+			mergeLocalGeo(enriched, info)
+			// Cross-check with ASN list, the provider may report another ASN
+			if _, ok := IsKnownDatacenterASN(enriched.ASN); ok {
+				markDatacenterASN(enriched)
+			}
+			// Known residential ISP overrides external API's datacenter misclassification
+			if org, ok := IsKnownResidentialASN(enriched.ASN); ok {
+				markResidentialASN(enriched, org)
+			}
+			setUsageType(enriched)
+			applyOrgName(enriched, s.orgs)
+			applyHostname(enriched, host)
+			s.cacheSet(ip, enriched)
+			s.persistResult(ctx, ip, enriched)
+			return enriched, nil
+		}
+		// Caller went away, don't cache a degraded result
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return nil, ctx.Err()
+		}
+		if refresh {
+			return nil, errRefreshFailed
+		}
+		// All APIs failed, return local result. It is cached for this IP
+		// only: a degraded answer must not stand in for the whole network.
+		s.cache.Set(ip, info)
+		return info, nil
 	}
 
 	// 3b. No local DB — check persistent cache
-	if s.store != nil {
-		if stored, ok := s.store.Get(ip); ok {
+	if s.store != nil && !refresh {
+		if stored, storedAt, ok := s.storeGet(ctx, ip); ok {
+			markFromPersistentCache(stored)
 			// Known residential ISP overrides stale datacenter flag in cache
 			if org, ok := IsKnownResidentialASN(stored.ASN); ok {
-				stored.IsDatacenter = false
-				stored.ISP = org
+				markResidentialASN(stored, org)
+			}
+			setUsageType(stored)
+			// The ASN only became known now
+			if o, ok := s.overrides.match(ip, stored.ASN); ok {
+				applyOverride(stored, o)
 			}
 			stored.Cached = true
-			s.cache.Set(ip, stored)
+			s.cacheSet(ip, stored)
 			log.Printf("[lookup] %s → persistent cache (source=%s)", ip, stored.Source)
+			s.revalidateStored(ip, storedAt)
 			return stored, nil
 		}
 	}
 
-	// 5. No local DB, go directly to API chain
-	info := s.queryProviders(ip)
+	// 5. No local DB, go directly to API chain, resolving the hostname meanwhile
+	waitHostname := s.startHostnameLookup(ctx, ip)
+	info := s.queryProviders(ctx, ip)
+	host := waitHostname()
 	if info != nil {
 		// Cross-check with ASN list
 		if _, ok := IsKnownDatacenterASN(info.ASN); ok {
-			info.IsDatacenter = true
+			markDatacenterASN(info)
 		}
 		// Known residential ISP overrides datacenter (prevents external API misclassification)
 		if org, ok := IsKnownResidentialASN(info.ASN); ok {
-			info.IsDatacenter = false
-			info.ISP = org
+			markResidentialASN(info, org)
 		}
-		s.cache.Set(ip, info)
-		s.persistResult(ip, info)
+		setUsageType(info)
+		applyOrgName(info, s.orgs)
+		applyHostname(info, host)
+		s.persistResult(ctx, ip, info)
+		// The ASN only became known now; the stored result stays unaltered
+		if o, ok := s.overrides.match(ip, info.ASN); ok {
+			applyOverride(info, o)
+		}
+		s.cacheSet(ip, info)
 		return info, nil
 	}
 
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil, ctx.Err()
+	}
+
+	if refresh {
+		return nil, errRefreshFailed
+	}
+
 	// 6. All providers failed, return minimal info
 	fallback := &model.IPInfo{
 		IP:     ip,
 		Source: "none",
 	}
+	applyHostname(fallback, host)
+	s.negativeSet(ip, fallback)
 	return fallback, nil
 }
 
 // persistResult saves the lookup result to persistent cache if enabled.
-func (s *Service) persistResult(ip string, info *model.IPInfo) {
+// The write is detached from ctx cancellation: the result was already paid
+// for, so it is kept even if the client disconnects meanwhile.
+func (s *Service) persistResult(ctx context.Context, ip string, info *model.IPInfo) {
 	if s.store != nil {
-		s.store.Set(ip, info)
+		s.store.Set(context.WithoutCancel(ctx), ip, info)
+		if p, ok := s.sharedPrefix(ip, info); ok {
+			s.store.Set(context.WithoutCancel(ctx), p.String(), sharedCopy(info))
+		}
 	}
 }
 
-// queryProviders tries each provider in order until one succeeds.
-func (s *Service) queryProviders(ip string) *model.IPInfo {
+// queryProviders tries each provider in order until one succeeds,
+// or merges several providers by vote when consensus mode is enabled.
+func (s *Service) queryProviders(ctx context.Context, ip string) *model.IPInfo {
+	if s.consensusN > 1 {
+		return s.queryConsensus(ctx, ip)
+	}
+
 	for _, p := range s.providers {
-		if !p.Available() {
+		if ctx.Err() != nil {
+			log.Printf("[lookup] %s → aborted: %v", ip, ctx.Err())
+			return nil
+		}
+		if !p.Acquire() {
 			continue
 		}
 
-		p.RecordCall()
-		info, err := p.QueryFn(ip)
+		info, err := p.query(ctx, ip)
 		if err != nil {
-			log.Printf("[provider] %s failed for %s: %v", p.Name, ip, err)
+			log.Printf("[provider] %s failed for %s: %v", p.Name(), ip, err)
 			continue
 		}
+		annotateProviderResult(info, p)
 
 		log.Printf("[lookup] %s → %s (datacenter=%v proxy=%v vpn=%v)",
-			ip, p.Name, info.IsDatacenter, info.IsProxy, info.IsVPN)
+			ip, p.Name(), info.IsDatacenter, info.IsProxy, info.IsVPN)
 		return info
 	}
 
@@ -171,39 +401,107 @@ func (s *Service) queryProviders(ip string) *model.IPInfo {
 }
 
 // Stats returns service statistics.
-func (s *Service) Stats() *model.StatsResponse {
+func (s *Service) Stats(ctx context.Context) *model.StatsResponse {
 	providerStatuses := make([]model.ProviderStatus, len(s.providers))
 	for i, p := range s.providers {
+		q := p.Quota()
+		state, failures, openUntil := p.breaker.snapshot()
 		providerStatuses[i] = model.ProviderStatus{
-			Name:        p.Name,
+			Name:        p.Name(),
 			Available:   p.Available(),
-			RateLimit:   p.RateLimit,
+			RateLimit:   q.PerMinute,
 			UsedLastMin: p.UsedLastMinute(),
-			NeedsKey:    p.NeedsKey,
-			HasKey:      p.HasKey,
+			NeedsKey:    q.NeedsKey,
+			HasKey:      q.HasKey,
+			Detects:     p.Capabilities().Names(),
+
+			Breaker:             state.String(),
+			ConsecutiveFailures: failures,
+			Quota:               p.quotaStatus(),
+		}
+		if state != breakerClosed {
+			providerStatuses[i].BreakerRetryAt = openUntil.Format(time.RFC3339)
 		}
 	}
 
+	cs := s.cache.Stats()
 	resp := &model.StatsResponse{
-		CacheSize:              s.cache.Size(),
+		CacheSize:              cs.Entries,
 		CacheTTL:               s.cache.TTL().String(),
+		CacheMaxEntries:        s.cache.MaxEntries(),
+		CacheBytes:             cs.Bytes,
+		CacheMaxBytes:          s.cache.MaxBytes(),
+		CacheHits:              cs.Hits,
+		CachePrefixHits:        cs.PrefixHits,
+		CacheMisses:            cs.Misses,
+		CacheEvictions:         cs.Evictions,
+		CacheShards:            s.cache.Shards(),
+		CacheStaleHits:         s.staleHits.Load(),
 		PersistentCacheEnabled: s.store != nil,
+		InFlightLookups:        s.flights.inFlight(),
+		CoalescedLookups:       s.flights.coalesced.Load(),
 		Providers:              providerStatuses,
-		LocalDB:                s.localDB != nil,
-		KnownASNs:              len(DatacenterASNs),
+		LocalDB:                s.localDB.Loaded(),
+		KnownASNs:              knownDatacenterASNs(),
 	}
 
+	if lookups := cs.Hits + cs.Misses; lookups > 0 {
+		resp.CacheHitRatio = float64(cs.Hits) / float64(lookups)
+		resp.CacheMissRatio = float64(cs.Misses) / float64(lookups)
+	}
+	if s.negative != nil {
+		ns := s.negative.Stats()
+		resp.NegativeCacheSize = ns.Entries
+		resp.NegativeCacheHits = ns.Hits
+		resp.NegativeCacheTTL = s.negative.TTL().String()
+	}
+	if s.refresher != nil {
+		resp.CacheRefreshes = s.refresher.refreshes.Load()
+		resp.CacheRefreshFailures = s.refresher.failures.Load()
+	}
 	if s.store != nil {
-		resp.PersistentCacheSize = s.store.Size()
+		resp.PersistentCacheSize = s.store.Size(ctx)
+	}
+	if built := s.localDB.BuildEpoch(); !built.IsZero() {
+		resp.LocalDBBuildEpoch = built.Unix()
+		resp.LocalDBBuildDate = built.Format(time.RFC3339)
+	}
+	if s.torExits != nil {
+		n, updated := s.torExits.status()
+		resp.TorExitNodes = n
+		if !updated.IsZero() {
+			resp.TorListUpdatedAt = updated.UTC().Format(time.RFC3339)
+			resp.TorListAgeSeconds = int64(time.Since(updated).Seconds())
+		}
 	}
 
 	return resp
 }
 
+// ReloadLocalDB re-opens the MMDB files immediately.
+func (s *Service) ReloadLocalDB() error {
+	if s.localDB == nil {
+		return errors.New("local database not configured")
+	}
+	return s.localDB.Reload()
+}
+
+// LocalDBBuild returns the build time of the loaded MMDB, zero if none.
+func (s *Service) LocalDBBuild() time.Time {
+	return s.localDB.BuildEpoch()
+}
+
 // Close cleans up resources.
 func (s *Service) Close() {
+	s.refresher.Close()
 	s.cache.Stop()
+	if s.negative != nil {
+		s.negative.Stop()
+	}
 	s.localDB.Close()
+	s.asnLists.Close()
+	s.ranges.Close()
+	s.torExits.Close()
 	if s.store != nil {
 		s.store.Close()
 	}
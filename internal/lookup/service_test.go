@@ -0,0 +1,159 @@
+package lookup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/cache"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// newTestService builds a Service without local DB or store around the given providers.
+func newTestService(t *testing.T, providers ...Provider) *Service {
+	t.Helper()
+	svc := &Service{cache: cache.New(time.Hour, 0, 0), flights: newFlightGroup(), overrides: newOverrideSet()}
+	for _, p := range providers {
+		svc.providers = append(svc.providers, &chainProvider{Provider: p})
+	}
+	t.Cleanup(svc.cache.Stop)
+	return svc
+}
+
+func TestLookupAbortsProviderChainOnCancel(t *testing.T) {
+	var nextCalls atomic.Int32
+	slow := &FuncProvider{ProviderName: "slow", Limits: Quota{PerMinute: 10, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}}
+	next := &FuncProvider{ProviderName: "next", Limits: Quota{PerMinute: 10, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			nextCalls.Add(1)
+			return &model.IPInfo{IP: ip, Source: "next"}, nil
+		}}
+	svc := newTestService(t, slow, next)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := svc.Lookup(ctx, "93.184.100.1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("lookup took %s after cancel", elapsed)
+	}
+	if n := nextCalls.Load(); n != 0 {
+		t.Fatalf("next provider called %d times after cancel", n)
+	}
+	if _, ok := svc.cache.Get("93.184.100.1"); ok {
+		t.Fatal("canceled lookup should not be cached")
+	}
+}
+
+func TestLookupDeadlineReturnsFallback(t *testing.T) {
+	slow := &FuncProvider{ProviderName: "slow", Limits: Quota{PerMinute: 10, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}}
+	svc := newTestService(t, slow)
+	svc.lookupTimeout = 20 * time.Millisecond
+
+	info, err := svc.Lookup(context.Background(), "93.184.100.2")
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if info.Source != "none" {
+		t.Fatalf("source = %q, want none", info.Source)
+	}
+}
+
+func TestLookupCoalescesConcurrentRequests(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	p := &FuncProvider{ProviderName: "gated", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			<-release
+			return &model.IPInfo{IP: ip, Source: "gated"}, nil
+		}}
+	svc := newTestService(t, p)
+
+	const n = 20
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			info, err := svc.Lookup(context.Background(), "93.184.100.3")
+			if err == nil && info.Source != "gated" {
+				err = errors.New("unexpected source " + info.Source)
+			}
+			errs <- err
+		}()
+	}
+
+	// Wait until every caller has joined the single in-flight lookup.
+	deadline := time.Now().Add(time.Second)
+	for svc.flights.coalesced.Load() < n-1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("provider called %d times, want 1", got)
+	}
+	if got := svc.flights.coalesced.Load(); got != n-1 {
+		t.Fatalf("coalesced = %d, want %d", got, n-1)
+	}
+}
+
+func TestLookupKeepsSharedFlightWhenOneCallerLeaves(t *testing.T) {
+	release := make(chan struct{})
+	p := &FuncProvider{ProviderName: "gated", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			select {
+			case <-release:
+				return &model.IPInfo{IP: ip, Source: "gated"}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}}
+	svc := newTestService(t, p)
+
+	leaving, leave := context.WithCancel(context.Background())
+	leftErr := make(chan error, 1)
+	go func() {
+		_, err := svc.Lookup(leaving, "93.184.100.4")
+		leftErr <- err
+	}()
+	for svc.flights.inFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stayed := make(chan *model.IPInfo, 1)
+	go func() {
+		info, _ := svc.Lookup(context.Background(), "93.184.100.4")
+		stayed <- info
+	}()
+	for svc.flights.coalesced.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	leave()
+	if err := <-leftErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leaving caller err = %v", err)
+	}
+	close(release)
+	if info := <-stayed; info == nil || info.Source != "gated" {
+		t.Fatalf("remaining caller got %+v", info)
+	}
+}
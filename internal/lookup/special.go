@@ -0,0 +1,214 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/akl7777777/ip-intel/internal/iptrie"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// SourcePrivate is the Source of results for special-purpose and bogon
+// addresses, which are never sent to providers.
+const SourcePrivate = "private"
+
+// Reserved types reported in IPInfo.ReservedType.
+const (
+	ReservedThisNetwork    = "this-network"
+	ReservedPrivate        = "private"
+	ReservedCGNAT          = "cgnat"
+	ReservedLoopback       = "loopback"
+	ReservedLinkLocal      = "link-local"
+	ReservedIETFProtocol   = "ietf-protocol"
+	ReservedDocumentation  = "documentation"
+	ReservedBenchmarking   = "benchmarking"
+	ReservedMulticast      = "multicast"
+	ReservedFuture         = "reserved"
+	ReservedBroadcast      = "broadcast"
+	ReservedUnspecified    = "unspecified"
+	ReservedDiscard        = "discard"
+	ReservedDeprecated     = "deprecated"
+	ReservedUniqueLocal    = "unique-local"
+	ReservedSegmentRouting = "segment-routing"
+	ReservedNAT64Local     = "nat64-local"
+	ReservedUnallocated    = "unallocated"
+	ReservedBogon          = "bogon"
+)
+
+// specialRange is an entry of the IANA special-purpose address registries.
+// Globally reachable entries (anycast services such as AS112) nested in a
+// reserved block are looked up like public addresses.
+type specialRange struct {
+	Type   string
+	Global bool
+}
+
+// specialRanges holds the IANA IPv4 and IPv6 Special-Purpose Address
+// Registries. IPv6 space outside 2000::/3 that is not listed is unallocated.
+// Ranges that embed an IPv4 address (mapped, NAT64, 6to4, Teredo) are handled
+// by embeddedIPv4 before this table is consulted.
+var specialRanges = func() *iptrie.Trie[specialRange] {
+	t := iptrie.New[specialRange]()
+	for cidr, r := range map[string]specialRange{
+		// IPv4, RFC 6890 and updates
+		"0.0.0.0/8":          {Type: ReservedThisNetwork},
+		"10.0.0.0/8":         {Type: ReservedPrivate},
+		"100.64.0.0/10":      {Type: ReservedCGNAT},
+		"127.0.0.0/8":        {Type: ReservedLoopback},
+		"169.254.0.0/16":     {Type: ReservedLinkLocal},
+		"172.16.0.0/12":      {Type: ReservedPrivate},
+		"192.0.0.0/24":       {Type: ReservedIETFProtocol},
+		"192.0.0.9/32":       {Global: true}, // Port Control Protocol anycast
+		"192.0.0.10/32":      {Global: true}, // TURN anycast
+		"192.0.2.0/24":       {Type: ReservedDocumentation},
+		"192.31.196.0/24":    {Global: true},             // AS112-v4
+		"192.52.193.0/24":    {Global: true},             // AMT
+		"192.88.99.0/24":     {Type: ReservedDeprecated}, // 6to4 relay anycast
+		"192.168.0.0/16":     {Type: ReservedPrivate},
+		"192.175.48.0/24":    {Global: true}, // AS112 direct delegation
+		"198.18.0.0/15":      {Type: ReservedBenchmarking},
+		"198.51.100.0/24":    {Type: ReservedDocumentation},
+		"203.0.113.0/24":     {Type: ReservedDocumentation},
+		"224.0.0.0/4":        {Type: ReservedMulticast},
+		"240.0.0.0/4":        {Type: ReservedFuture},
+		"255.255.255.255/32": {Type: ReservedBroadcast},
+
+		// IPv6, RFC 6890 and updates
+		"::/0":              {Type: ReservedUnallocated},
+		"2000::/3":          {Global: true},
+		"::/128":            {Type: ReservedUnspecified},
+		"::1/128":           {Type: ReservedLoopback},
+		"64:ff9b:1::/48":    {Type: ReservedNAT64Local},
+		"100::/64":          {Type: ReservedDiscard},
+		"2001::/23":         {Type: ReservedIETFProtocol},
+		"2001:1::1/128":     {Global: true}, // Port Control Protocol anycast
+		"2001:1::2/128":     {Global: true}, // TURN anycast
+		"2001:1::3/128":     {Global: true}, // DNS-SD SRP anycast
+		"2001:2::/48":       {Type: ReservedBenchmarking},
+		"2001:3::/32":       {Global: true},             // AMT
+		"2001:4:112::/48":   {Global: true},             // AS112-v6
+		"2001:10::/28":      {Type: ReservedDeprecated}, // ORCHID
+		"2001:20::/28":      {Global: true},             // ORCHIDv2
+		"2001:30::/28":      {Global: true},             // Drone remote ID
+		"2001:db8::/32":     {Type: ReservedDocumentation},
+		"2620:4f:8000::/48": {Global: true}, // AS112 direct delegation
+		"3fff::/20":         {Type: ReservedDocumentation},
+		"5f00::/16":         {Type: ReservedSegmentRouting},
+		"fc00::/7":          {Type: ReservedUniqueLocal},
+		"fe80::/10":         {Type: ReservedLinkLocal},
+		"ff00::/8":          {Type: ReservedMulticast},
+	} {
+		t.Insert(netip.MustParsePrefix(cidr), r)
+	}
+	return t
+}()
+
+var (
+	nat64Prefix  = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour    = netip.MustParsePrefix("2002::/16")
+	teredoPrefix = netip.MustParsePrefix("2001::/32")
+)
+
+// embeddedIPv4 returns the IPv4 address carried by an IPv4-mapped, NAT64
+// well-known prefix (RFC 6052), 6to4 (RFC 3056) or Teredo (RFC 4380) address.
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	if addr.Is4In6() {
+		return addr.Unmap(), true
+	}
+	if !addr.Is6() {
+		return netip.Addr{}, false
+	}
+	a := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(a[12:16])), true
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(a[2:6])), true
+	case teredoPrefix.Contains(addr):
+		// The client address is stored inverted in the last 32 bits
+		var v4 [4]byte
+		binary.BigEndian.PutUint32(v4[:], ^binary.BigEndian.Uint32(a[12:16]))
+		return netip.AddrFrom4(v4), true
+	}
+	return netip.Addr{}, false
+}
+
+// ReservedType returns the special-purpose range addr belongs to, e.g.
+// "private", "cgnat" or "documentation". It reports false for globally
+// routable addresses. Addresses embedding an IPv4 address should be
+// unwrapped with embeddedIPv4 first.
+func ReservedType(addr netip.Addr) (string, bool) {
+	_, r, ok := specialRanges.Lookup(addr)
+	if !ok || r.Global {
+		return "", false
+	}
+	return r.Type, true
+}
+
+// reservedType checks the IANA registries, then the configured bogon lists.
+func (s *Service) reservedType(addr netip.Addr) (string, bool) {
+	if typ, ok := ReservedType(addr); ok {
+		return typ, true
+	}
+	if s.bogons != nil && s.bogons.Contains(addr) {
+		return ReservedBogon, true
+	}
+	return "", false
+}
+
+// lookupSpecial answers addresses that must not reach providers and unwraps
+// embedded IPv4 addresses. handled is false for ordinary addresses.
+func (s *Service) lookupSpecial(ctx context.Context, ip string) (info *model.IPInfo, handled bool, err error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, false, nil
+	}
+	if v4, ok := embeddedIPv4(addr); ok {
+		inner, err := s.Lookup(ctx, v4.String())
+		if err != nil {
+			return nil, true, err
+		}
+		// The inner result may be shared through the cache
+		wrapped := *inner
+		wrapped.IP = ip
+		wrapped.EmbeddedIPv4 = v4.String()
+		return &wrapped, true, nil
+	}
+	if typ, ok := s.reservedType(addr); ok {
+		return &model.IPInfo{IP: ip, Source: SourcePrivate, ReservedType: typ}, true, nil
+	}
+	return nil, false, nil
+}
+
+// loadBogons reads plain CIDR lists such as Team Cymru's fullbogons.
+func loadBogons(paths []string) (*iptrie.Trie[struct{}], error) {
+	t := iptrie.New[struct{}]()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; sc.Scan(); line++ {
+			text := strings.TrimSpace(sc.Text())
+			if text == "" || text[0] == '#' {
+				continue
+			}
+			p, err := parsePrefix(text)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			t.Insert(p, struct{}{})
+		}
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,143 @@
+package lookup
+
+import (
+	"context"
+	"net/netip"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestReservedType(t *testing.T) {
+	for ip, want := range map[string]string{
+		"10.1.2.3":         ReservedPrivate,
+		"172.31.0.1":       ReservedPrivate,
+		"100.64.0.1":       ReservedCGNAT,
+		"100.127.255.254":  ReservedCGNAT,
+		"169.254.169.254":  ReservedLinkLocal,
+		"0.1.2.3":          ReservedThisNetwork,
+		"127.0.0.1":        ReservedLoopback,
+		"192.0.0.8":        ReservedIETFProtocol,
+		"192.0.2.1":        ReservedDocumentation,
+		"198.51.100.7":     ReservedDocumentation,
+		"203.0.113.200":    ReservedDocumentation,
+		"198.19.255.1":     ReservedBenchmarking,
+		"224.0.0.251":      ReservedMulticast,
+		"240.0.0.1":        ReservedFuture,
+		"255.255.255.255":  ReservedBroadcast,
+		"::":               ReservedUnspecified,
+		"::1":              ReservedLoopback,
+		"fd12:3456::1":     ReservedUniqueLocal,
+		"fe80::1":          ReservedLinkLocal,
+		"ff02::1":          ReservedMulticast,
+		"2001:db8::1":      ReservedDocumentation,
+		"3fff:1::1":        ReservedDocumentation,
+		"2001:2::1":        ReservedBenchmarking,
+		"100::1":           ReservedDiscard,
+		"4000::1":          ReservedUnallocated,
+		"::ffff:0:0:0:1:0": ReservedUnallocated,
+	} {
+		got, ok := ReservedType(netip.MustParseAddr(ip))
+		if !ok || got != want {
+			t.Errorf("ReservedType(%s) = %q, %v, want %q", ip, got, ok, want)
+		}
+	}
+
+	// Public, including globally reachable anycast inside reserved blocks
+	for _, ip := range []string{"8.8.8.8", "100.128.0.1", "192.0.0.9", "192.175.48.1", "2606:4700::1111", "2001:4:112::1"} {
+		if got, ok := ReservedType(netip.MustParseAddr(ip)); ok {
+			t.Errorf("ReservedType(%s) = %q, want public", ip, got)
+		}
+	}
+}
+
+func TestEmbeddedIPv4(t *testing.T) {
+	for ip, want := range map[string]string{
+		"::ffff:8.8.8.8":                       "8.8.8.8",
+		"64:ff9b::808:808":                     "8.8.8.8",
+		"2002:808:808::1":                      "8.8.8.8",
+		"2001:0:4136:e378:8000:63bf:f7f7:f7f7": "8.8.8.8", // Teredo, client bits inverted
+	} {
+		got, ok := embeddedIPv4(netip.MustParseAddr(ip))
+		if !ok || got.String() != want {
+			t.Errorf("embeddedIPv4(%s) = %s, %v, want %s", ip, got, ok, want)
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "2606:4700::1111"} {
+		if got, ok := embeddedIPv4(netip.MustParseAddr(ip)); ok {
+			t.Errorf("embeddedIPv4(%s) = %s, want none", ip, got)
+		}
+	}
+}
+
+func TestLookupSkipsReservedAndUnwrapsEmbedded(t *testing.T) {
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 100, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			return &model.IPInfo{IP: ip, ASN: 15169, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+
+	for ip, want := range map[string]string{
+		"100.64.1.1":      ReservedCGNAT,
+		"::ffff:10.0.0.1": ReservedPrivate,
+		"2002:c000:201::": ReservedDocumentation, // 6to4 of 192.0.2.1
+	} {
+		info, err := svc.Lookup(context.Background(), ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Source != SourcePrivate || info.ReservedType != want || info.IP != ip {
+			t.Errorf("%s: source=%q reserved_type=%q ip=%q, want %q", ip, info.Source, info.ReservedType, info.IP, want)
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Fatalf("provider queried %d times for reserved addresses", n)
+	}
+
+	info, err := svc.Lookup(context.Background(), "2002:808:808::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IP != "2002:808:808::1" || info.EmbeddedIPv4 != "8.8.8.8" || info.ASN != 15169 {
+		t.Fatalf("6to4: got ip=%q embedded=%q asn=%d", info.IP, info.EmbeddedIPv4, info.ASN)
+	}
+	// The IPv4 result is cached under the IPv4 address and shared
+	if _, err := svc.Lookup(context.Background(), "::ffff:8.8.8.8"); err != nil {
+		t.Fatal(err)
+	}
+	if cached, ok := svc.cache.Get("8.8.8.8"); !ok || cached.IP != "8.8.8.8" || cached.EmbeddedIPv4 != "" {
+		t.Fatalf("cached IPv4 result = %+v, %v", cached, ok)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("provider queried %d times, want 1", n)
+	}
+}
+
+func TestBogonFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fullbogons-ipv4.txt")
+	writeFile(t, path, "# last updated 2026-10-16\n41.62.0.0/16\n2c0f:fe00::/29\n")
+
+	bogons, err := loadBogons([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newTestService(t)
+	svc.bogons = bogons
+
+	info, err := svc.Lookup(context.Background(), "41.62.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ReservedType != ReservedBogon {
+		t.Fatalf("reserved_type = %q, want bogon", info.ReservedType)
+	}
+
+	writeFile(t, path, "41.62.0.0/33\n")
+	if _, err := loadBogons([]string{path}); err == nil {
+		t.Fatal("expected error for an invalid prefix")
+	}
+}
@@ -0,0 +1,283 @@
+package lookup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// SourceTorList is the provenance of is_tor when set from the Tor exit list.
+const SourceTorList = "tor-exit-list"
+
+// confidenceTorList is used for IPs found on the Tor exit list. The list is
+// published by the Tor Project itself, but exits come and go between refreshes.
+const confidenceTorList = 0.99
+
+// maxTorListBytes bounds a downloaded exit list. An Onionoo details document
+// for all exits is a few MB.
+const maxTorListBytes = 64 << 20
+
+// torFetchTimeout bounds one download of a remote exit list.
+const torFetchTimeout = 30 * time.Second
+
+// torExitList holds the Tor exit addresses loaded from TOR_EXIT_LIST, a file
+// path or an http(s) URL, and refreshes them periodically.
+type torExitList struct {
+	source string
+
+	mu        sync.RWMutex
+	addrs     map[netip.Addr]struct{}
+	updatedAt time.Time // publication time of the list, or when it was loaded
+	stamp     fileStamp // last loaded version of a local file
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// newTorExitList loads the list from source. If loading fails, lookups run
+// without Tor detection until a refresh succeeds. With refresh > 0 the list
+// is reloaded periodically; a local file only when it changed.
+func newTorExitList(source string, refresh time.Duration) *torExitList {
+	l := &torExitList{
+		source: source,
+		stopCh: make(chan struct{}),
+	}
+	if err := l.Refresh(context.Background()); err != nil {
+		log.Printf("[tor] %v, Tor exit detection disabled until the next refresh", err)
+	}
+	if refresh > 0 {
+		go l.watch(refresh)
+	}
+	return l
+}
+
+func (l *torExitList) remote() bool {
+	return strings.HasPrefix(l.source, "http://") || strings.HasPrefix(l.source, "https://")
+}
+
+// Refresh loads the list again and swaps it in. On error the current list
+// stays active.
+func (l *torExitList) Refresh(ctx context.Context) error {
+	var (
+		data  []byte
+		stamp fileStamp
+		err   error
+	)
+	if l.remote() {
+		data, err = fetchTorList(ctx, l.source)
+	} else {
+		stamp = statFile(l.source)
+		data, err = os.ReadFile(l.source)
+	}
+	if err != nil {
+		return fmt.Errorf("load exit list %s: %w", l.source, err)
+	}
+
+	addrs, published, err := parseTorExitList(data)
+	if err != nil {
+		return fmt.Errorf("parse exit list %s: %w", l.source, err)
+	}
+	if published.IsZero() {
+		published = time.Now()
+		if !stamp.modTime.IsZero() {
+			published = stamp.modTime
+		}
+	}
+
+	l.mu.Lock()
+	l.addrs, l.updatedAt, l.stamp = addrs, published, stamp
+	l.mu.Unlock()
+	log.Printf("[tor] Loaded %d exit addresses from %s", len(addrs), l.source)
+	return nil
+}
+
+func fetchTorList(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, torFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// httpClient's timeout is sized for per-IP lookups, not list downloads.
+	resp, err := (&http.Client{Transport: httpClient.Transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &httpStatusError{Code: resp.StatusCode, Body: string(body)}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTorListBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTorListBytes {
+		return nil, fmt.Errorf("exit list larger than %d bytes", maxTorListBytes)
+	}
+	return data, nil
+}
+
+// onionooDocument is the subset of an Onionoo details or summary document
+// used here, e.g. https://onionoo.torproject.org/details?flag=Exit&fields=exit_addresses,or_addresses,flags
+type onionooDocument struct {
+	RelaysPublished string `json:"relays_published"` // "2006-01-02 15:04:05", UTC
+	Relays          []struct {
+		ExitAddresses []string `json:"exit_addresses"`
+		ORAddresses   []string `json:"or_addresses"` // "ip:port" or "[ipv6]:port"
+		Flags         []string `json:"flags"`        // e.g. "Exit", "Guard"
+		Addresses     []string `json:"a"`            // summary documents
+	} `json:"relays"`
+}
+
+// parseTorExitList parses an Onionoo JSON document or a plain-text list: the
+// bulk exit list (one IP per line) or the exit-addresses format ("ExitAddress
+// <ip> <date> <time>" lines). Lines starting with "#" and lines that hold no
+// address are ignored. published is zero if the list does not carry a
+// publication time. A list without any address is an error in both formats,
+// so that a truncated download does not replace the active list.
+func parseTorExitList(data []byte) (addrs map[netip.Addr]struct{}, published time.Time, err error) {
+	addrs = make(map[netip.Addr]struct{})
+	add := func(s string) {
+		if host, _, err := net.SplitHostPort(s); err == nil {
+			s = host
+		}
+		if addr, err := netip.ParseAddr(strings.TrimSpace(s)); err == nil {
+			addrs[addr.Unmap()] = struct{}{}
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var doc onionooDocument
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, time.Time{}, err
+		}
+		for _, r := range doc.Relays {
+			switch {
+			case len(r.ExitAddresses) > 0:
+				for _, a := range r.ExitAddresses {
+					add(a)
+				}
+			case len(r.Addresses) > 0:
+				for _, a := range r.Addresses {
+					add(a)
+				}
+			case slices.Contains(r.Flags, "Exit"):
+				// Exits without a separate exit address exit from their OR
+				// address; guard and middle relays don't exit at all
+				for _, a := range r.ORAddresses {
+					add(a)
+				}
+			}
+		}
+		published, _ = time.Parse(time.DateTime, doc.RelaysPublished)
+	} else {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			fields := strings.Fields(line)
+			switch {
+			case fields[0] == "ExitAddress" && len(fields) > 1:
+				add(fields[1])
+			case fields[0] == "Downloaded" && len(fields) > 2:
+				if t, err := time.Parse(time.DateTime, fields[1]+" "+fields[2]); err == nil {
+					published = t
+				}
+			case len(fields) == 1:
+				add(fields[0])
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, time.Time{}, errors.New("no addresses found")
+	}
+	return addrs, published, nil
+}
+
+// Contains reports whether ip is a listed Tor exit.
+func (l *torExitList) Contains(ip string) bool {
+	if l == nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.addrs[addr.Unmap()]
+	return ok
+}
+
+// status returns the number of listed exits and when the list was published.
+func (l *torExitList) status() (n int, updatedAt time.Time) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.addrs), l.updatedAt
+}
+
+func (l *torExitList) changed() bool {
+	if l.remote() {
+		return true
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return !statFile(l.source).equal(l.stamp)
+}
+
+func (l *torExitList) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !l.changed() {
+				continue
+			}
+			if err := l.Refresh(context.Background()); err != nil {
+				log.Printf("[tor] Refresh failed, keeping current list: %v", err)
+			}
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// Close stops the periodic refresh.
+func (l *torExitList) Close() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stopCh) })
+}
+
+// markTorExit flags info as a Tor exit found on the exit list.
+func markTorExit(info *model.IPInfo) {
+	info.IsTor = true
+	setProvenance(info, SourceTorList, "is_tor")
+	setConfidence(info, "is_tor", confidenceTorList)
+}
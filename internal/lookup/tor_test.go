@@ -0,0 +1,157 @@
+package lookup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestParseTorExitListFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		want      []string
+		published string
+	}{
+		{
+			name: "bulk",
+			data: "# exits\n185.220.101.1\n\n2001:db8::1\nnot-an-ip\n",
+			want: []string{"185.220.101.1", "2001:db8::1"},
+		},
+		{
+			name: "exit-addresses",
+			data: "Downloaded 2026-10-16 08:02:01\nExitNode 0011BD2485AD45D984EC4159C88FC066E5E3300E\n" +
+				"Published 2026-10-15 14:15:55\nExitAddress 162.247.74.201 2026-10-15 14:33:58\n",
+			want:      []string{"162.247.74.201"},
+			published: "2026-10-16T08:02:01Z",
+		},
+		{
+			name: "onionoo details",
+			data: `{"relays_published":"2026-10-16 07:00:00","relays":[
+				{"exit_addresses":["185.220.101.2"],"or_addresses":["10.0.0.1:9001"],"flags":["Exit","Running"]},
+				{"or_addresses":["185.220.101.3:443","[2001:db8::2]:9001"],"flags":["Exit","Fast"]},
+				{"or_addresses":["198.51.100.7:9001"],"flags":["Guard","Running"]},
+				{"or_addresses":["198.51.100.8:9001"]}]}`,
+			want:      []string{"185.220.101.2", "185.220.101.3", "2001:db8::2"},
+			published: "2026-10-16T07:00:00Z",
+		},
+		{
+			name: "onionoo summary",
+			data: `{"relays":[{"n":"relay","a":["185.220.101.4","2001:db8::3"]}]}`,
+			want: []string{"185.220.101.4", "2001:db8::3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, published, err := parseTorExitList([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != len(tt.want) {
+				t.Fatalf("got %d addresses, want %d: %v", len(addrs), len(tt.want), addrs)
+			}
+			l := &torExitList{addrs: addrs}
+			for _, ip := range tt.want {
+				if !l.Contains(ip) {
+					t.Errorf("%s not listed", ip)
+				}
+			}
+			if got := formatTime(published); got != tt.published {
+				t.Errorf("published = %q, want %q", got, tt.published)
+			}
+		})
+	}
+
+	for _, empty := range []string{"# empty\n", `{"relays":[]}`} {
+		if _, _, err := parseTorExitList([]byte(empty)); err == nil {
+			t.Errorf("expected error for a list without addresses: %s", empty)
+		}
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func TestTorExitListFromURLRefreshes(t *testing.T) {
+	var body atomic.Value
+	body.Store("185.220.101.1\n")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	l := newTorExitList(srv.URL, 0)
+	defer l.Close()
+	if !l.Contains("185.220.101.1") || l.Contains("185.220.101.9") {
+		t.Fatal("initial list not loaded")
+	}
+
+	body.Store("185.220.101.9\n")
+	if err := l.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if l.Contains("185.220.101.1") || !l.Contains("185.220.101.9") {
+		t.Fatal("refreshed list not swapped in")
+	}
+
+	// A failed refresh keeps the current list
+	body.Store("")
+	if err := l.Refresh(context.Background()); err == nil {
+		t.Fatal("expected error for an empty list")
+	}
+	if n, updated := l.status(); n != 1 || updated.IsZero() {
+		t.Fatalf("status = %d, %v", n, updated)
+	}
+}
+
+func TestLookupMarksTorExitBeforeProviders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exits.txt")
+	writeFile(t, path, "185.220.101.1\n")
+
+	var calls atomic.Int32
+	p := &FuncProvider{ProviderName: "api", Limits: Quota{PerMinute: 10, HasKey: true},
+		QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) {
+			calls.Add(1)
+			return &model.IPInfo{IP: ip, Source: "api"}, nil
+		}}
+	svc := newTestService(t, p)
+	svc.torExits = newTorExitList(path, 0)
+	t.Cleanup(svc.torExits.Close)
+
+	info, err := svc.Lookup(context.Background(), "185.220.101.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsTor || info.Source != SourceTorList {
+		t.Fatalf("got tor=%v source=%q", info.IsTor, info.Source)
+	}
+	if info.Provenance["is_tor"] != SourceTorList || info.Confidence["is_tor"] != confidenceTorList {
+		t.Fatalf("provenance %v, confidence %v", info.Provenance, info.Confidence)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("provider queried for a listed exit")
+	}
+
+	info, err = svc.Lookup(context.Background(), "93.184.100.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsTor || info.Source != "api" {
+		t.Fatalf("unlisted IP: tor=%v source=%q", info.IsTor, info.Source)
+	}
+
+	stats := svc.Stats(context.Background())
+	if stats.TorExitNodes != 1 || stats.TorListUpdatedAt == "" {
+		t.Fatalf("stats = %d nodes, updated %q", stats.TorExitNodes, stats.TorListUpdatedAt)
+	}
+}
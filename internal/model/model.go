@@ -1,41 +1,136 @@
 package model
 
+import "time"
+
 // IPInfo is the result of an IP intelligence lookup.
 type IPInfo struct {
-	IP           string `json:"ip"`
-	IsDatacenter bool   `json:"is_datacenter"`
-	IsProxy      bool   `json:"is_proxy"`
-	IsVPN        bool   `json:"is_vpn"`
-	IsTor        bool   `json:"is_tor"`
-	ASN          int    `json:"asn"`
-	ASNOrg       string `json:"asn_org"`
-	ISP          string `json:"isp"`
-	Country      string `json:"country"`
-	CountryCode  string `json:"country_code"`
-	City         string `json:"city"`
-	Source       string `json:"source"`
-	Cached       bool   `json:"cached"`
+	IP           string  `json:"ip"`
+	EmbeddedIPv4 string  `json:"embedded_ipv4,omitempty"` // IPv4 address unwrapped from a mapped, NAT64, 6to4 or Teredo address
+	ReservedType string  `json:"reserved_type,omitempty"` // special-purpose range, e.g. "private", "cgnat", "documentation"
+	IsDatacenter bool    `json:"is_datacenter"`
+	IsProxy      bool    `json:"is_proxy"`
+	IsVPN        bool    `json:"is_vpn"`
+	IsTor        bool    `json:"is_tor"`
+	ASN          int     `json:"asn"`
+	ASNOrg       string  `json:"asn_org"`
+	ISP          string  `json:"isp"`
+	Hostname     string  `json:"hostname,omitempty"`      // PTR record, when reverse DNS is enabled
+	UsageType    string  `json:"usage_type"`              // cloud, hosting, cdn, vpn, mobile, isp, education, government; empty = unknown
+	CloudService string  `json:"cloud_service,omitempty"` // published cloud range, e.g. "AWS EC2 us-east-1"
+	Country      string  `json:"country"`
+	CountryCode  string  `json:"country_code"`
+	City         string  `json:"city"`
+	Region       string  `json:"region"`
+	Latitude     float64 `json:"latitude,omitempty"`
+	Longitude    float64 `json:"longitude,omitempty"`
+	Timezone     string  `json:"timezone"`
+	Source       string  `json:"source"`
+	Cached       bool    `json:"cached"`
+
+	Consensus *Consensus `json:"consensus,omitempty"`
+
+	// Provenance maps a JSON field name (e.g. "asn", "is_datacenter") to the
+	// source that supplied it: "mmdb", "asn-list", "consensus", a provider
+	// name, or "persistent-cache/<original source>".
+	Provenance map[string]string `json:"provenance,omitempty"`
+	// Confidence maps a security flag name to a value in [0, 1] describing
+	// how much the reported value can be trusted. Absent = not determined.
+	Confidence map[string]float64 `json:"confidence,omitempty"`
+}
+
+// Consensus describes how a result merged from several providers was reached.
+type Consensus struct {
+	Providers []string            `json:"providers"` // providers that answered
+	Flags     map[string]FlagVote `json:"flags"`     // keyed by JSON flag name, e.g. "is_proxy"
+}
+
+// FlagVote is the vote tally for one security flag.
+type FlagVote struct {
+	Agreed int `json:"agreed"` // providers whose answer matches the merged value
+	Voters int `json:"voters"` // providers able to report this flag
+}
+
+// Override is an admin-managed classification override for an ASN or a CIDR.
+// Exactly one of ASN and CIDR is set.
+type Override struct {
+	ASN       int       `json:"asn,omitempty"`
+	CIDR      string    `json:"cidr,omitempty"`
+	Category  string    `json:"category"` // datacenter, residential, vpn, proxy or allow
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // ProviderStatus represents the status of an external API provider.
 type ProviderStatus struct {
-	Name        string `json:"name"`
-	Available   bool   `json:"available"`
-	RateLimit   int    `json:"rate_limit_per_min"`
-	UsedLastMin int    `json:"used_last_min"`
-	NeedsKey    bool   `json:"needs_key"`
-	HasKey      bool   `json:"has_key"`
+	Name        string   `json:"name"`
+	Available   bool     `json:"available"`
+	RateLimit   int      `json:"rate_limit_per_min"`
+	UsedLastMin int      `json:"used_last_min"`
+	NeedsKey    bool     `json:"needs_key"`
+	HasKey      bool     `json:"has_key"`
+	Detects     []string `json:"detects"` // security flags the provider reports, empty = geo only
+
+	Breaker             string `json:"breaker"`                    // circuit breaker state: closed, open, half-open
+	BreakerRetryAt      string `json:"breaker_retry_at,omitempty"` // when an open breaker lets a probe through (RFC 3339)
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+
+	Quota *QuotaStatus `json:"quota,omitempty"` // nil = no daily/monthly quota
+}
+
+// QuotaStatus reports a provider's daily and monthly quota usage.
+type QuotaStatus struct {
+	Daily   *QuotaWindow `json:"daily,omitempty"`
+	Monthly *QuotaWindow `json:"monthly,omitempty"`
+}
+
+// QuotaWindow is the usage of one quota period.
+type QuotaWindow struct {
+	Period    string `json:"period"` // e.g. "day:2026-10-16", UTC
+	Limit     int    `json:"limit"`
+	Used      int    `json:"used"`
+	Remaining int    `json:"remaining"`
 }
 
 // StatsResponse is returned by the /stats endpoint.
 type StatsResponse struct {
-	CacheSize            int              `json:"cache_size"`
-	CacheTTL             string           `json:"cache_ttl"`
-	PersistentCacheEnabled bool           `json:"persistent_cache_enabled"`
-	PersistentCacheSize  int              `json:"persistent_cache_size"`
-	Providers            []ProviderStatus `json:"providers"`
-	LocalDB              bool             `json:"local_db_loaded"`
-	KnownASNs            int              `json:"known_datacenter_asns"`
+	CacheSize              int              `json:"cache_size"`
+	CacheTTL               string           `json:"cache_ttl"`
+	CacheMaxEntries        int              `json:"cache_max_entries"`            // 0 = unlimited
+	CacheBytes             int64            `json:"cache_bytes"`                  // estimated memory held by cached entries
+	CacheMaxBytes          int64            `json:"cache_max_bytes"`              // 0 = unlimited
+	CacheHits              int64            `json:"cache_hits"`                   // lookups answered from the in-memory cache
+	CachePrefixHits        int64            `json:"cache_prefix_hits"`            // hits answered by the shared entry of the IP's network
+	CacheMisses            int64            `json:"cache_misses"`                 // lookups that were not
+	CacheHitRatio          float64          `json:"cache_hit_ratio"`              // hits / (hits + misses)
+	CacheMissRatio         float64          `json:"cache_miss_ratio"`             // misses / (hits + misses)
+	CacheEvictions         int64            `json:"cache_evictions"`              // entries evicted by the LRU limits
+	CacheStaleHits         int64            `json:"cache_stale_hits"`             // hits older than the soft TTL, served while being renewed
+	CacheRefreshes         int64            `json:"cache_refreshes"`              // background refreshes that renewed an entry
+	CacheRefreshFailures   int64            `json:"cache_refresh_failures"`       // background refreshes that kept the stale entry
+	CacheShards            int              `json:"cache_shards"`                 // lock stripes of the in-memory cache
+	NegativeCacheSize      int              `json:"negative_cache_size"`          // failed lookups remembered
+	NegativeCacheHits      int64            `json:"negative_cache_hits"`          // lookups answered with a remembered failure
+	NegativeCacheTTL       string           `json:"negative_cache_ttl,omitempty"` // how long failed lookups are remembered
+	PersistentCacheEnabled bool             `json:"persistent_cache_enabled"`
+	PersistentCacheSize    int              `json:"persistent_cache_size"`
+	InFlightLookups        int              `json:"inflight_lookups"`
+	CoalescedLookups       int64            `json:"coalesced_lookups"` // lookups answered by sharing an in-flight lookup for the same IP
+	Providers              []ProviderStatus `json:"providers"`
+	LocalDB                bool             `json:"local_db_loaded"`
+	LocalDBBuildEpoch      int64            `json:"local_db_build_epoch,omitempty"`
+	LocalDBBuildDate       string           `json:"local_db_build_date,omitempty"`
+	KnownASNs              int              `json:"known_datacenter_asns"`
+	TorExitNodes           int              `json:"tor_exit_nodes,omitempty"`
+	TorListUpdatedAt       string           `json:"tor_list_updated_at,omitempty"`  // publication time of the exit list (RFC 3339)
+	TorListAgeSeconds      int64            `json:"tor_list_age_seconds,omitempty"` // seconds since the exit list was published
+}
+
+// BatchResult is one entry of a POST /batch response. Exactly one of
+// Result or Error is set.
+type BatchResult struct {
+	IP     string  `json:"ip"`
+	Result *IPInfo `json:"result,omitempty"`
+	Error  string  `json:"error,omitempty"`
 }
 
 // ErrorResponse is returned on error.
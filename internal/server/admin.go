@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/lookup"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// maxAdminBodyBytes caps the request body of admin endpoints.
+const maxAdminBodyBytes = 64 << 10
+
+// handleReloadMMDB re-opens the MMDB file without restarting the service.
+func (s *Server) handleReloadMMDB(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := s.service.ReloadLocalDB(); err != nil {
+		writeError(w, http.StatusInternalServerError, "reload failed: "+err.Error())
+		return
+	}
+
+	built := s.service.LocalDBBuild()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"reloaded":             true,
+		"local_db_build_epoch": built.Unix(),
+		"local_db_build_date":  built.Format(time.RFC3339),
+	})
+}
+
+// handleASNOverrides manages ASN classification overrides:
+//
+//	GET    /-/admin/asn          list
+//	POST   /-/admin/asn          {"asn": 64496, "category": "vpn", "note": "..."}
+//	DELETE /-/admin/asn/{asn}    remove
+func (s *Server) handleASNOverrides(w http.ResponseWriter, r *http.Request) {
+	s.handleOverrides(w, r, "/-/admin/asn", func(target string) (model.Override, bool) {
+		asn, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(target), "AS"))
+		return model.Override{ASN: asn}, err == nil
+	}, func(o model.Override) bool { return o.ASN != 0 })
+}
+
+// handleCIDROverrides manages CIDR classification overrides:
+//
+//	GET    /-/admin/cidr                 list
+//	POST   /-/admin/cidr                 {"cidr": "203.0.113.0/24", "category": "vpn", "note": "..."}
+//	DELETE /-/admin/cidr/{ip}/{bits}     remove
+func (s *Server) handleCIDROverrides(w http.ResponseWriter, r *http.Request) {
+	s.handleOverrides(w, r, "/-/admin/cidr", func(target string) (model.Override, bool) {
+		return model.Override{CIDR: target}, target != ""
+	}, func(o model.Override) bool { return o.CIDR != "" })
+}
+
+// handleOverrides implements list/add/remove for one override kind. parse
+// turns the path suffix of a DELETE into an override key, and owns reports
+// whether an override belongs to this kind.
+func (s *Server) handleOverrides(w http.ResponseWriter, r *http.Request, base string,
+	parse func(target string) (model.Override, bool), owns func(model.Override) bool) {
+
+	target := strings.Trim(strings.TrimPrefix(r.URL.Path, base), "/")
+
+	switch {
+	case r.Method == http.MethodGet && target == "":
+		list := []model.Override{}
+		for _, o := range s.service.Overrides() {
+			if owns(o) {
+				list = append(list, o)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"overrides": list,
+			"persisted": s.service.OverridesPersisted(),
+		})
+
+	case r.Method == http.MethodPost && target == "":
+		var o model.Override
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxAdminBodyBytes)).Decode(&o); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if !owns(o) {
+			writeError(w, http.StatusBadRequest, "missing "+strings.TrimPrefix(base, "/-/admin/"))
+			return
+		}
+		o, err := s.service.PutOverride(r.Context(), o)
+		if err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, o)
+
+	case r.Method == http.MethodDelete && target != "":
+		o, ok := parse(target)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "invalid target: "+target)
+			return
+		}
+		if err := s.service.DeleteOverride(r.Context(), o); err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func writeOverrideError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, lookup.ErrInvalidOverride):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, lookup.ErrOverrideNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
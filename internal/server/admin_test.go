@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+func TestAdminAuth(t *testing.T) {
+	cases := []struct {
+		name  string
+		env   map[string]string
+		token string
+		want  int
+	}{
+		{"no keys", nil, "", http.StatusForbidden},
+		{"no keys with token", nil, "secret", http.StatusForbidden},
+		{"auth key fallback, no token", map[string]string{"AUTH_KEY": "secret"}, "", http.StatusUnauthorized},
+		{"auth key fallback, wrong token", map[string]string{"AUTH_KEY": "secret"}, "wrong", http.StatusUnauthorized},
+		{"auth key fallback", map[string]string{"AUTH_KEY": "secret"}, "secret", http.StatusOK},
+		{"admin key", map[string]string{"AUTH_KEY": "secret", "ADMIN_KEY": "admin"}, "admin", http.StatusOK},
+		{"admin key, auth token", map[string]string{"AUTH_KEY": "secret", "ADMIN_KEY": "admin"}, "secret", http.StatusUnauthorized},
+		{"admin key only", map[string]string{"ADMIN_KEY": "admin"}, "admin", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := newTestServer(t, c.env, answer)
+			for _, path := range []string{"/-/admin/asn", "/-/admin/cidr"} {
+				if rec := serve(srv, http.MethodGet, path, c.token, ""); rec.Code != c.want {
+					t.Errorf("GET %s: status = %d, want %d", path, rec.Code, c.want)
+				}
+			}
+		})
+	}
+}
+
+// listOverrides returns the overrides listed by GET path.
+func listOverrides(t *testing.T, srv *Server, path string) []model.Override {
+	t.Helper()
+	rec := serve(srv, http.MethodGet, path, "admin", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status = %d: %s", path, rec.Code, rec.Body)
+	}
+	var resp struct {
+		Overrides []model.Override `json:"overrides"`
+		Persisted bool             `json:"persisted"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Overrides
+}
+
+func TestAdminASNOverrides(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"ADMIN_KEY": "admin"}, answer)
+
+	if rec := serve(srv, http.MethodPost, "/-/admin/asn", "admin", `{"asn": 64496, "category": "vpn", "note": "test"}`); rec.Code != http.StatusOK {
+		t.Fatalf("POST: status = %d: %s", rec.Code, rec.Body)
+	}
+	if list := listOverrides(t, srv, "/-/admin/asn"); len(list) != 1 || list[0].ASN != 64496 || list[0].Category != "vpn" || list[0].Note != "test" {
+		t.Fatalf("ASN overrides = %+v", list)
+	}
+	if list := listOverrides(t, srv, "/-/admin/cidr"); len(list) != 0 {
+		t.Fatalf("CIDR overrides = %+v", list)
+	}
+
+	if rec := serve(srv, http.MethodDelete, "/-/admin/asn/AS64496", "admin", ""); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := serve(srv, http.MethodDelete, "/-/admin/asn/64496", "admin", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("second DELETE: status = %d, want 404", rec.Code)
+	}
+	if list := listOverrides(t, srv, "/-/admin/asn"); len(list) != 0 {
+		t.Fatalf("ASN overrides after delete = %+v", list)
+	}
+
+	for _, body := range []string{`{"asn": 64496, "category": "cloud"}`, `{"category": "vpn"}`, `not json`} {
+		if rec := serve(srv, http.MethodPost, "/-/admin/asn", "admin", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: status = %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := serve(srv, http.MethodDelete, "/-/admin/asn/abc", "admin", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("DELETE abc: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdminCIDROverrides(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"ADMIN_KEY": "admin"}, answer)
+
+	if rec := serve(srv, http.MethodPost, "/-/admin/cidr", "admin", `{"cidr": "203.0.113.0/24", "category": "datacenter"}`); rec.Code != http.StatusOK {
+		t.Fatalf("POST: status = %d: %s", rec.Code, rec.Body)
+	}
+	if list := listOverrides(t, srv, "/-/admin/cidr"); len(list) != 1 || list[0].CIDR != "203.0.113.0/24" || list[0].Category != "datacenter" {
+		t.Fatalf("CIDR overrides = %+v", list)
+	}
+	if list := listOverrides(t, srv, "/-/admin/asn"); len(list) != 0 {
+		t.Fatalf("ASN overrides = %+v", list)
+	}
+
+	if rec := serve(srv, http.MethodDelete, "/-/admin/cidr/203.0.113.0/24", "admin", ""); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE: status = %d: %s", rec.Code, rec.Body)
+	}
+	if list := listOverrides(t, srv, "/-/admin/cidr"); len(list) != 0 {
+		t.Fatalf("CIDR overrides after delete = %+v", list)
+	}
+
+	if rec := serve(srv, http.MethodPost, "/-/admin/cidr", "admin", `{"cidr": "203.0.113.0/33", "category": "vpn"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid CIDR: status = %d, want 400", rec.Code)
+	}
+	if rec := serve(srv, http.MethodPut, "/-/admin/cidr", "admin", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT: status = %d, want 405", rec.Code)
+	}
+}
@@ -2,29 +2,46 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/akl7777777/ip-intel/internal/config"
 	"github.com/akl7777777/ip-intel/internal/lookup"
 	"github.com/akl7777777/ip-intel/internal/model"
 )
 
+// maxBatchBodyBytes caps the request body of POST /batch.
+const maxBatchBodyBytes = 1 << 20
+
 // Server is the HTTP server.
 type Server struct {
-	service *lookup.Service
-	authKey string
-	mux     *http.ServeMux
+	service          *lookup.Service
+	authKey          string
+	adminKey         string
+	batchMaxSize     int
+	batchConcurrency int
+	mux              *http.ServeMux
 }
 
 // New creates a new HTTP server.
-func New(svc *lookup.Service, authKey string) *Server {
+func New(svc *lookup.Service, cfg *config.Config) *Server {
 	s := &Server{
-		service: svc,
-		authKey: authKey,
-		mux:     http.NewServeMux(),
+		service:          svc,
+		authKey:          cfg.AuthKey,
+		adminKey:         cfg.AdminKey,
+		batchMaxSize:     cfg.BatchMaxSize,
+		batchConcurrency: cfg.BatchConcurrency,
+		mux:              http.NewServeMux(),
+	}
+	if s.batchConcurrency <= 0 {
+		s.batchConcurrency = 1
 	}
 	s.routes()
 	return s
@@ -33,6 +50,12 @@ func New(svc *lookup.Service, authKey string) *Server {
 func (s *Server) routes() {
 	s.mux.HandleFunc("/-/health", s.handleHealth)
 	s.mux.HandleFunc("/-/stats", s.handleStats)
+	s.mux.HandleFunc("/-/admin/mmdb/reload", s.handleReloadMMDB)
+	s.mux.HandleFunc("/-/admin/asn", s.handleASNOverrides)
+	s.mux.HandleFunc("/-/admin/asn/", s.handleASNOverrides)
+	s.mux.HandleFunc("/-/admin/cidr", s.handleCIDROverrides)
+	s.mux.HandleFunc("/-/admin/cidr/", s.handleCIDROverrides)
+	s.mux.HandleFunc("/batch", s.handleBatch)
 	s.mux.HandleFunc("/", s.handleLookup) // catch-all: /{ip}
 }
 
@@ -41,7 +64,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// CORS
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
@@ -49,15 +72,23 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Admin endpoints always require the admin key
+	if strings.HasPrefix(r.URL.Path, "/-/admin/") {
+		if s.adminKey == "" {
+			writeError(w, http.StatusForbidden, "admin API disabled: set ADMIN_KEY or AUTH_KEY")
+			log.Printf("[http] %s %s 403 admin disabled %s", r.Method, r.URL.Path, time.Since(start))
+			return
+		}
+		if bearerToken(r) != s.adminKey {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			log.Printf("[http] %s %s 401 unauthorized %s", r.Method, r.URL.Path, time.Since(start))
+			return
+		}
+	}
+
 	// Auth check (skip for /-/ operational endpoints)
 	if s.authKey != "" && !strings.HasPrefix(r.URL.Path, "/-/") {
-		auth := r.Header.Get("Authorization")
-		token := strings.TrimPrefix(auth, "Bearer ")
-		if token == "" || token == auth {
-			// No Bearer prefix, try raw value
-			token = auth
-		}
-		if token != s.authKey {
+		if bearerToken(r) != s.authKey {
 			writeError(w, http.StatusUnauthorized, "unauthorized")
 			log.Printf("[http] %s %s 401 unauthorized %s", r.Method, r.URL.Path, time.Since(start))
 			return
@@ -83,6 +114,7 @@ func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, map[string]string{
 			"service": "ip-intel",
 			"usage":   "GET /{ip}",
+			"batch":   "POST /batch",
 			"health":  "GET /-/health",
 			"stats":   "GET /-/stats",
 		})
@@ -95,17 +127,12 @@ func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Skip private/reserved IPs
-	if isPrivateIP(ip) {
-		writeJSON(w, http.StatusOK, &model.IPInfo{
-			IP:     ip,
-			Source: "private",
-		})
-		return
-	}
-
-	info, err := s.service.Lookup(ip)
+	info, err := s.service.Lookup(r.Context(), ip)
 	if err != nil {
+		if r.Context().Err() != nil {
+			// Client went away, nobody is waiting for the answer
+			return
+		}
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -113,6 +140,87 @@ func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, info)
 }
 
+// handleBatch looks up a JSON array of IPs in one request.
+// Duplicate IPs are looked up once; lookups run with bounded concurrency and
+// go through the same provider rate limiting as single lookups.
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var ips []string
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBatchBodyBytes)).Decode(&ips); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: expected a JSON array of IP strings")
+		return
+	}
+	if len(ips) == 0 {
+		writeError(w, http.StatusBadRequest, "empty IP list")
+		return
+	}
+	if s.batchMaxSize > 0 && len(ips) > s.batchMaxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("too many IPs: %d (max %d)", len(ips), s.batchMaxSize))
+		return
+	}
+
+	results := make([]model.BatchResult, len(ips))
+	positions := make(map[string][]int) // canonical IP → indexes in results
+	var unique []string
+
+	for i, raw := range ips {
+		ip := strings.TrimSpace(raw)
+		results[i].IP = ip
+
+		parsed, err := netip.ParseAddr(ip)
+		if err != nil || parsed.Zone() != "" {
+			results[i].Error = "invalid IP address format"
+			continue
+		}
+
+		key := parsed.String()
+		if _, seen := positions[key]; !seen {
+			unique = append(unique, key)
+		}
+		positions[key] = append(positions[key], i)
+	}
+
+	ctx := r.Context()
+	sem := make(chan struct{}, s.batchConcurrency)
+	var wg sync.WaitGroup
+	for _, ip := range unique {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			info, err := s.service.Lookup(ctx, ip)
+			for _, i := range positions[ip] {
+				if err != nil {
+					results[i].Error = err.Error()
+				} else {
+					results[i].Result = info
+				}
+			}
+		}(ip)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		log.Printf("[batch] aborted: %v", ctx.Err())
+		return
+	}
+
+	log.Printf("[batch] %d IPs (%d unique lookups)", len(ips), len(unique))
+	writeJSON(w, http.StatusOK, results)
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ok",
@@ -120,7 +228,19 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, s.service.Stats())
+	writeJSON(w, http.StatusOK, s.service.Stats(r.Context()))
+}
+
+// bearerToken extracts the token from the Authorization header.
+// Both "Bearer <token>" and a raw token value are accepted.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token == "" || token == auth {
+		// No Bearer prefix, try raw value
+		token = auth
+	}
+	return token
 }
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -135,30 +255,3 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 		Code:  status,
 	})
 }
-
-func isPrivateIP(ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
-	}
-
-	privateRanges := []struct {
-		network string
-	}{
-		{"10.0.0.0/8"},
-		{"172.16.0.0/12"},
-		{"192.168.0.0/16"},
-		{"127.0.0.0/8"},
-		{"::1/128"},
-		{"fc00::/7"},
-		{"fe80::/10"},
-	}
-
-	for _, r := range privateRanges {
-		_, cidr, _ := net.ParseCIDR(r.network)
-		if cidr.Contains(ip) {
-			return true
-		}
-	}
-	return false
-}
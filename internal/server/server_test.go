@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akl7777777/ip-intel/internal/config"
+	"github.com/akl7777777/ip-intel/internal/lookup"
+	"github.com/akl7777777/ip-intel/internal/model"
+)
+
+// stubQuery answers the lookups of the test servers.
+var stubQuery func(ctx context.Context, ip string) (*model.IPInfo, error)
+
+func init() {
+	lookup.Register("stub", func(*config.Config) lookup.Provider {
+		return &lookup.FuncProvider{ProviderName: "stub", Limits: lookup.Quota{PerMinute: 1000, HasKey: true},
+			QueryFn: func(ctx context.Context, ip string) (*model.IPInfo, error) { return stubQuery(ctx, ip) }}
+	})
+}
+
+// newTestServer returns a server configured from env on top of the defaults,
+// without an MMDB, whose lookups are answered by query.
+func newTestServer(t *testing.T, env map[string]string, query func(ctx context.Context, ip string) (*model.IPInfo, error)) *Server {
+	t.Helper()
+	t.Setenv("AUTH_KEY", "")
+	t.Setenv("ADMIN_KEY", "")
+	t.Setenv("MMDB_PATH", filepath.Join(t.TempDir(), "missing.mmdb"))
+	t.Setenv("ENABLED_PROVIDERS", "stub")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	stubQuery = query
+
+	cfg := config.Load()
+	svc := lookup.NewService(cfg)
+	t.Cleanup(svc.Close)
+	return New(svc, cfg)
+}
+
+// answer is a stub query that answers every IP.
+func answer(ctx context.Context, ip string) (*model.IPInfo, error) {
+	return &model.IPInfo{IP: ip, Source: "stub"}, nil
+}
+
+// serve sends a request to srv with an optional bearer token.
+func serve(srv *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBatchLooksUpEachIPOnce(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	srv := newTestServer(t, nil, func(ctx context.Context, ip string) (*model.IPInfo, error) {
+		mu.Lock()
+		calls[ip]++
+		mu.Unlock()
+		return answer(ctx, ip)
+	})
+
+	body := `["93.184.100.2", "93.184.100.1", " 93.184.100.2 ", "not-an-ip", "fe80::1%eth0", "2a01:db8::1", "2a01:0db8:0::1"]`
+	rec := serve(srv, http.MethodPost, "/batch", "", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var results []model.BatchResult
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ ip, result, err string }{
+		{"93.184.100.2", "93.184.100.2", ""},
+		{"93.184.100.1", "93.184.100.1", ""},
+		{"93.184.100.2", "93.184.100.2", ""},
+		{"not-an-ip", "", "invalid IP address format"},
+		{"fe80::1%eth0", "", "invalid IP address format"},
+		{"2a01:db8::1", "2a01:db8::1", ""},
+		{"2a01:0db8:0::1", "2a01:db8::1", ""},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("%d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		var got string
+		if r.Result != nil {
+			got = r.Result.IP
+		}
+		if r.IP != w.ip || got != w.result || r.Error != w.err {
+			t.Errorf("result %d = %q %q %q, want %q %q %q", i, r.IP, got, r.Error, w.ip, w.result, w.err)
+		}
+	}
+
+	if len(calls) != 3 {
+		t.Fatalf("looked up %v, want 3 distinct IPs", calls)
+	}
+	for ip, n := range calls {
+		if n != 1 {
+			t.Errorf("%s looked up %d times", ip, n)
+		}
+	}
+}
+
+func TestBatchBoundsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	srv := newTestServer(t, map[string]string{"BATCH_CONCURRENCY": "2"}, func(ctx context.Context, ip string) (*model.IPInfo, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return answer(ctx, ip)
+	})
+
+	var ips []string
+	for i := 1; i <= 10; i++ {
+		ips = append(ips, fmt.Sprintf("93.184.100.%d", i))
+	}
+	body, _ := json.Marshal(ips)
+	if rec := serve(srv, http.MethodPost, "/batch", "", string(body)); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Fatalf("%d lookups ran at once, want at most 2", p)
+	}
+}
+
+func TestBatchAbortsWhenClientGoesAway(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	srv := newTestServer(t, map[string]string{"BATCH_CONCURRENCY": "1"}, func(ctx context.Context, ip string) (*model.IPInfo, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`["93.184.100.1", "93.184.100.2", "93.184.100.3"]`))
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req.WithContext(ctx))
+
+	if rec.Body.Len() != 0 {
+		t.Fatalf("response written after the client left: %s", rec.Body)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("%d lookups started, want 1", n)
+	}
+}
+
+func TestBatchRejectsOversizedRequest(t *testing.T) {
+	srv := newTestServer(t, map[string]string{"BATCH_MAX_SIZE": "2"}, answer)
+
+	rec := serve(srv, http.MethodPost, "/batch", "", `["93.184.100.1", "93.184.100.2", "93.184.100.3"]`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", rec.Code)
+	}
+	if rec := serve(srv, http.MethodPost, "/batch", "", `[]`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("empty list: status = %d, want 400", rec.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -47,6 +48,32 @@ func NewMySQL(dsn string, ttl time.Duration) (Store, error) {
 		return nil, err
 	}
 
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS provider_usage (
+			provider VARCHAR(64) NOT NULL,
+			period   VARCHAR(20) NOT NULL,
+			count    BIGINT NOT NULL,
+			PRIMARY KEY (provider, period)
+		)
+	`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS overrides (
+			kind       VARCHAR(8) NOT NULL,
+			target     VARCHAR(64) NOT NULL,
+			category   VARCHAR(20) NOT NULL,
+			note       TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (kind, target)
+		)
+	`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	s := &mysqlStore{
 		db:   db,
 		ttl:  ttl,
@@ -58,28 +85,31 @@ func NewMySQL(dsn string, ttl time.Duration) (Store, error) {
 	return s, nil
 }
 
-func (s *mysqlStore) Get(ip string) (*model.IPInfo, bool) {
+func (s *mysqlStore) Get(ctx context.Context, ip string) (*model.IPInfo, time.Time, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	cutoff := time.Now().Add(-s.ttl).Unix()
-	var data string
-	err := s.db.QueryRow(
-		"SELECT data FROM ip_cache WHERE ip = ? AND updated_at > ?",
+	var (
+		data    string
+		updated int64
+	)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT data, updated_at FROM ip_cache WHERE ip = ? AND updated_at > ?",
 		ip, cutoff,
-	).Scan(&data)
+	).Scan(&data, &updated)
 	if err != nil {
-		return nil, false
+		return nil, time.Time{}, false
 	}
 
 	var info model.IPInfo
 	if json.Unmarshal([]byte(data), &info) != nil {
-		return nil, false
+		return nil, time.Time{}, false
 	}
-	return &info, true
+	return &info, time.Unix(updated, 0), true
 }
 
-func (s *mysqlStore) Set(ip string, info *model.IPInfo) {
+func (s *mysqlStore) Set(ctx context.Context, ip string, info *model.IPInfo) {
 	data, err := json.Marshal(info)
 	if err != nil {
 		return
@@ -88,24 +118,86 @@ func (s *mysqlStore) Set(ip string, info *model.IPInfo) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, _ = s.db.Exec(
+	_, _ = s.db.ExecContext(ctx,
 		`INSERT INTO ip_cache (ip, data, source, updated_at) VALUES (?, ?, ?, ?)
 		 ON DUPLICATE KEY UPDATE data=VALUES(data), source=VALUES(source), updated_at=VALUES(updated_at)`,
 		ip, string(data), info.Source, time.Now().Unix(),
 	)
 }
 
-func (s *mysqlStore) Size() int {
+func (s *mysqlStore) Size(ctx context.Context) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var count int
-	if err := s.db.QueryRow("SELECT COUNT(*) FROM ip_cache").Scan(&count); err != nil {
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ip_cache").Scan(&count); err != nil {
 		return 0
 	}
 	return count
 }
 
+func (s *mysqlStore) GetUsage(ctx context.Context, provider, period string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT count FROM provider_usage WHERE provider = ? AND period = ?",
+		provider, period,
+	).Scan(&count)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+func (s *mysqlStore) AddUsage(ctx context.Context, provider, period string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, _ = s.db.ExecContext(ctx,
+		`INSERT INTO provider_usage (provider, period, count) VALUES (?, ?, ?)
+		 ON DUPLICATE KEY UPDATE count = count + VALUES(count)`,
+		provider, period, n,
+	)
+}
+
+func (s *mysqlStore) ListOverrides(ctx context.Context) ([]model.Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT kind, target, category, note, created_at FROM overrides ORDER BY kind, target")
+	if err != nil {
+		return nil, err
+	}
+	return scanOverrides(rows)
+}
+
+func (s *mysqlStore) PutOverride(ctx context.Context, o model.Override) error {
+	kind, target := overrideKey(o)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO overrides (kind, target, category, note, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON DUPLICATE KEY UPDATE category=VALUES(category), note=VALUES(note), created_at=VALUES(created_at)`,
+		kind, target, o.Category, o.Note, o.CreatedAt.Unix(),
+	)
+	return err
+}
+
+func (s *mysqlStore) DeleteOverride(ctx context.Context, o model.Override) error {
+	kind, target := overrideKey(o)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM overrides WHERE kind = ? AND target = ?", kind, target)
+	return err
+}
+
 func (s *mysqlStore) Cleanup() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
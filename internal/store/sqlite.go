@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -52,6 +53,32 @@ func NewSQLite(dbPath string, ttl time.Duration) (Store, error) {
 		return nil, err
 	}
 
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS provider_usage (
+			provider TEXT NOT NULL,
+			period   TEXT NOT NULL,
+			count    INTEGER NOT NULL,
+			PRIMARY KEY (provider, period)
+		)
+	`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS overrides (
+			kind       TEXT NOT NULL,
+			target     TEXT NOT NULL,
+			category   TEXT NOT NULL,
+			note       TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (kind, target)
+		)
+	`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	s := &sqliteStore{
 		db:   db,
 		ttl:  ttl,
@@ -63,28 +90,31 @@ func NewSQLite(dbPath string, ttl time.Duration) (Store, error) {
 	return s, nil
 }
 
-func (s *sqliteStore) Get(ip string) (*model.IPInfo, bool) {
+func (s *sqliteStore) Get(ctx context.Context, ip string) (*model.IPInfo, time.Time, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	cutoff := time.Now().Add(-s.ttl).Unix()
-	var data string
-	err := s.db.QueryRow(
-		"SELECT data FROM ip_cache WHERE ip = ? AND updated_at > ?",
+	var (
+		data    string
+		updated int64
+	)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT data, updated_at FROM ip_cache WHERE ip = ? AND updated_at > ?",
 		ip, cutoff,
-	).Scan(&data)
+	).Scan(&data, &updated)
 	if err != nil {
-		return nil, false
+		return nil, time.Time{}, false
 	}
 
 	var info model.IPInfo
 	if json.Unmarshal([]byte(data), &info) != nil {
-		return nil, false
+		return nil, time.Time{}, false
 	}
-	return &info, true
+	return &info, time.Unix(updated, 0), true
 }
 
-func (s *sqliteStore) Set(ip string, info *model.IPInfo) {
+func (s *sqliteStore) Set(ctx context.Context, ip string, info *model.IPInfo) {
 	data, err := json.Marshal(info)
 	if err != nil {
 		return
@@ -93,24 +123,86 @@ func (s *sqliteStore) Set(ip string, info *model.IPInfo) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	_, _ = s.db.Exec(
+	_, _ = s.db.ExecContext(ctx,
 		`INSERT INTO ip_cache (ip, data, source, updated_at) VALUES (?, ?, ?, ?)
 		 ON CONFLICT(ip) DO UPDATE SET data=excluded.data, source=excluded.source, updated_at=excluded.updated_at`,
 		ip, string(data), info.Source, time.Now().Unix(),
 	)
 }
 
-func (s *sqliteStore) Size() int {
+func (s *sqliteStore) Size(ctx context.Context) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var count int
-	if err := s.db.QueryRow("SELECT COUNT(*) FROM ip_cache").Scan(&count); err != nil {
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ip_cache").Scan(&count); err != nil {
 		return 0
 	}
 	return count
 }
 
+func (s *sqliteStore) GetUsage(ctx context.Context, provider, period string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT count FROM provider_usage WHERE provider = ? AND period = ?",
+		provider, period,
+	).Scan(&count)
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+func (s *sqliteStore) AddUsage(ctx context.Context, provider, period string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, _ = s.db.ExecContext(ctx,
+		`INSERT INTO provider_usage (provider, period, count) VALUES (?, ?, ?)
+		 ON CONFLICT(provider, period) DO UPDATE SET count = count + excluded.count`,
+		provider, period, n,
+	)
+}
+
+func (s *sqliteStore) ListOverrides(ctx context.Context) ([]model.Override, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT kind, target, category, note, created_at FROM overrides ORDER BY kind, target")
+	if err != nil {
+		return nil, err
+	}
+	return scanOverrides(rows)
+}
+
+func (s *sqliteStore) PutOverride(ctx context.Context, o model.Override) error {
+	kind, target := overrideKey(o)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO overrides (kind, target, category, note, created_at) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(kind, target) DO UPDATE SET category=excluded.category, note=excluded.note, created_at=excluded.created_at`,
+		kind, target, o.Category, o.Note, o.CreatedAt.Unix(),
+	)
+	return err
+}
+
+func (s *sqliteStore) DeleteOverride(ctx context.Context, o model.Override) error {
+	kind, target := overrideKey(o)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM overrides WHERE kind = ? AND target = ?", kind, target)
+	return err
+}
+
 func (s *sqliteStore) Cleanup() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -1,17 +1,32 @@
 package store
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/akl7777777/ip-intel/internal/model"
 )
 
 // Store is the interface for persistent IP cache backends.
+// Methods taking a context abort the underlying query when ctx is done.
 type Store interface {
-	Get(ip string) (*model.IPInfo, bool)
-	Set(ip string, info *model.IPInfo)
-	Size() int
+	// Get returns the stored result for ip and when it was stored.
+	Get(ctx context.Context, ip string) (*model.IPInfo, time.Time, bool)
+	Set(ctx context.Context, ip string, info *model.IPInfo)
+	Size(ctx context.Context) int
+
+	// Provider quota usage, keyed by provider name and period (e.g. "day:2026-10-16").
+	GetUsage(ctx context.Context, provider, period string) int
+	AddUsage(ctx context.Context, provider, period string, n int)
+
+	// Classification overrides managed through the admin API.
+	ListOverrides(ctx context.Context) ([]model.Override, error)
+	PutOverride(ctx context.Context, o model.Override) error
+	DeleteOverride(ctx context.Context, o model.Override) error
+
 	Cleanup()
 	Close()
 }
@@ -28,3 +43,36 @@ func New(storeType, dsn string, ttl time.Duration) (Store, error) {
 		return nil, fmt.Errorf("unsupported store type: %s (supported: sqlite, mysql)", storeType)
 	}
 }
+
+// overrideKey returns the table key of an override: kind "asn" or "cidr"
+// and the ASN number or CIDR as text.
+func overrideKey(o model.Override) (kind, target string) {
+	if o.CIDR != "" {
+		return "cidr", o.CIDR
+	}
+	return "asn", strconv.Itoa(o.ASN)
+}
+
+// scanOverrides reads (kind, target, category, note, created_at) rows.
+func scanOverrides(rows *sql.Rows) ([]model.Override, error) {
+	defer rows.Close()
+
+	var list []model.Override
+	for rows.Next() {
+		var (
+			kind, target, category, note string
+			created                      int64
+		)
+		if err := rows.Scan(&kind, &target, &category, &note, &created); err != nil {
+			return nil, err
+		}
+		o := model.Override{Category: category, Note: note, CreatedAt: time.Unix(created, 0).UTC()}
+		if kind == "cidr" {
+			o.CIDR = target
+		} else {
+			o.ASN, _ = strconv.Atoi(target)
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
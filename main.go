@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
 	"net/http"
-	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/akl7777777/ip-intel/internal/config"
 	"github.com/akl7777777/ip-intel/internal/lookup"
@@ -20,21 +22,31 @@ func main() {
 	svc := lookup.NewService(cfg)
 	defer svc.Close()
 
-	srv := server.New(svc, cfg.AuthKey)
+	srv := server.New(svc, cfg)
+
+	// Canceled on SIGINT/SIGTERM. Request contexts derive from it, so
+	// in-flight lookups abort their provider calls on shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	addr := cfg.Host + ":" + cfg.Port
 	httpServer := &http.Server{
-		Addr:    addr,
-		Handler: srv,
+		Addr:        addr,
+		Handler:     srv,
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	// Graceful shutdown
+	shutdownDone := make(chan struct{})
 	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
+		defer close(shutdownDone)
+		<-ctx.Done()
 		log.Println("[main] Shutting down...")
-		httpServer.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			httpServer.Close()
+		}
 	}()
 
 	authStatus := "disabled"
@@ -47,6 +59,7 @@ func main() {
 	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("[main] Server error: %v", err)
 	}
+	<-shutdownDone
 
 	log.Println("[main] Server stopped")
 }
@@ -3,7 +3,8 @@
 # Source: https://github.com/sapics/ip-location-db
 #
 # Safe update: downloads to temp file first, replaces only on success.
-# The service can hot-reload without restart.
+# The running service picks up the new file automatically (MMDB_RELOAD_INTERVAL_SECONDS)
+# or immediately via POST /-/admin/mmdb/reload.
 
 set -e
 